@@ -17,46 +17,308 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
+// +kubebuilder:validation:XValidation:rule="!has(self.host) || !has(self.__namespace__)",message="host and namespace are mutually exclusive"
+// +kubebuilder:validation:XValidation:rule="!has(self.host) || !has(self.selector)",message="host and selector are mutually exclusive"
+// +kubebuilder:validation:XValidation:rule="has(self.port) != has(self.portName)",message="exactly one of port and portName is required"
+// +kubebuilder:validation:XValidation:rule="!has(self.portName) || !has(self.host)",message="portName can not be used with host"
 type TSProxyService struct {
 	//+required
 	// Name of the service to proxy
 	Name string `json:"name"`
 
-	//+required
+	//+optional
+	// Namespace of the service to proxy, defaults to the namespace of the TSProxy.
+	// Another namespace must permit this namespace with a TSProxyGrant.
+	Namespace string `json:"namespace,omitempty"`
+
+	//+optional
+	// Host is an external hostname or IP address to proxy instead of a service,
+	// which must be permitted by the operator's allowed external destinations.
+	// Name then only identifies the target in the status and metrics.
+	Host string `json:"host,omitempty"`
+
+	//+optional
+	// Selector selects the pods to proxy directly, instead of a service.
+	// Connections are spread over the Ready pods. Name then only identifies the target in the status and metrics.
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	//+optional
 	// +kubebuilder:validation:Minimum=1
 	// +kubebuilder:validation:Maximum=65535
 	// +kubebuilder:validation:ExclusiveMinimum=false
 	// +kubebuilder:validation:ExclusiveMaximum=false
-	// ServicePort contains the port on the service to proxy
-	ServicePort int32 `json:"port"`
+	// ServicePort contains the port on the service, host or pods to proxy
+	ServicePort int32 `json:"port,omitempty"`
 
-	//+required
+	//+optional
+	// PortName is the name of the port to proxy on the service, or of the container port on the selected pods, instead of port.
+	// A changed port number on the service is followed without rebinding exposeAs.
+	PortName string `json:"portName,omitempty"`
+
+	//+optional
 	// +kubebuilder:validation:Minimum=1
 	// +kubebuilder:validation:Maximum=65535
 	// +kubebuilder:validation:ExclusiveMinimum=false
 	// +kubebuilder:validation:ExclusiveMaximum=false
-	// ExposeAs contains the port to expose the proxy on the host network
-	ExposeAs int32 `json:"exposeAs"`
+	// ExposeAs contains the port to expose the proxy on the host network.
+	// When omitted a port is allocated from the operator's port range and reported in the status.
+	ExposeAs int32 `json:"exposeAs,omitempty"`
+
+	//+optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=1000
+	// Count is the number of consecutive ports exposed, mapping exposeAs..exposeAs+count-1
+	// to port..port+count-1 on the service. The ports are managed as one unit. Defaults to 1.
+	Count int32 `json:"count,omitempty"`
+
+	//+optional
+	// Bandwidth limits the bytes per second proxied, per connection and for all connections together.
+	// Changes apply to open connections too.
+	Bandwidth *TSProxyBandwidth `json:"bandwidth,omitempty"`
+
+	//+optional
+	// ClientLimits limits the connections of each client IP address, checked before the target is dialed.
+	ClientLimits *TSProxyClientLimits `json:"clientLimits,omitempty"`
 }
 
+// TSProxyClientLimits limits the connections of each client IP address to the exposed ports of a service
+type TSProxyClientLimits struct {
+	//+optional
+	// +kubebuilder:validation:Minimum=1
+	// ConnectionsPerSecond limits the new connections per second from each client, allowing bursts of as many
+	ConnectionsPerSecond int32 `json:"connectionsPerSecond,omitempty"`
+
+	//+optional
+	// +kubebuilder:validation:Minimum=1
+	// MaxConnections limits the open connections from each client
+	MaxConnections int32 `json:"maxConnections,omitempty"`
+}
+
+// TSProxyBandwidth limits the bandwidth of a service
+type TSProxyBandwidth struct {
+	//+optional
+	// PerConnection limits each connection on its own
+	PerConnection *TSProxyRate `json:"perConnection,omitempty"`
+
+	//+optional
+	// PerListener limits all connections to the exposed ports together
+	PerListener *TSProxyRate `json:"perListener,omitempty"`
+}
+
+// TSProxyRate limits the bytes per second in each direction, e.g. 10Mi. Omitted directions are unlimited.
+type TSProxyRate struct {
+	//+optional
+	// Upload limits the data sent by the clients to the target
+	Upload *resource.Quantity `json:"upload,omitempty"`
+
+	//+optional
+	// Download limits the data sent by the target to the clients
+	Download *resource.Quantity `json:"download,omitempty"`
+}
+
+// PortCount returns the number of consecutive ports exposed by the service
+func (s *TSProxyService) PortCount() int32 {
+	if s.Count < 1 {
+		return 1
+	}
+	return s.Count
+}
+
+// ApplyPolicy decides how a TSProxy is applied when some of its services can not be started
+// +kubebuilder:validation:Enum=Partial;Atomic
+type ApplyPolicy string
+
+const (
+	// ApplyPartial starts every service that can be started and reports the rest
+	ApplyPartial ApplyPolicy = "Partial"
+
+	// ApplyAtomic starts all services or none of them
+	ApplyAtomic ApplyPolicy = "Atomic"
+)
+
 // TSProxySpec defines the desired state of TSProxy
 type TSProxySpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
 	Services []TSProxyService `json:"services,omitempty"`
+
+	//+optional
+	// +kubebuilder:default=Partial
+	// ApplyPolicy decides what happens when some of the services can not be started.
+	// Partial starts every non-conflicting service and reports the rest in the status.
+	// Atomic binds all new ports first and keeps the previous set of listeners if any of them fail.
+	ApplyPolicy ApplyPolicy `json:"applyPolicy,omitempty"`
+
+	//+optional
+	// ProxyClassName selects the tsproxy deployment handling this TSProxy, matching its --proxy-class.
+	// Empty is handled by the deployment marked with --default-class.
+	ProxyClassName string `json:"proxyClassName,omitempty"`
+
+	//+optional
+	// NodeSelector selects the nodes that expose the ports, by the labels of the node.
+	// Only used when the operator runs per node with --node-name. Defaults to all nodes.
+	NodeSelector *metav1.LabelSelector `json:"nodeSelector,omitempty"`
+
+	//+optional
+	// Tolerations allow exposing the ports on nodes with taints whose key starts with tsproxy.lindex.com/.
+	// Other taints are ignored.
+	Tolerations []TSProxyToleration `json:"tolerations,omitempty"`
+}
+
+// TSProxyToleration tolerates node taints like the toleration of a pod
+type TSProxyToleration struct {
+	//+optional
+	// Key is the taint key to match, empty matches all keys with the Exists operator
+	Key string `json:"key,omitempty"`
+
+	//+optional
+	//+kubebuilder:validation:Enum=Exists;Equal
+	// Operator is Exists or Equal, defaults to Equal
+	Operator string `json:"operator,omitempty"`
+
+	//+optional
+	// Value is the taint value to match with the Equal operator
+	Value string `json:"value,omitempty"`
+
+	//+optional
+	//+kubebuilder:validation:Enum=NoSchedule;NoExecute
+	// Effect is the taint effect to match, empty matches all effects
+	Effect string `json:"effect,omitempty"`
+}
+
+// ServiceState is the state of a single proxied service
+type ServiceState string
+
+const (
+	// ServiceActive means the exposed port is bound and accepting connections
+	ServiceActive ServiceState = "Active"
+
+	// ServiceConflict means the exposed port is owned by another TSProxy
+	ServiceConflict ServiceState = "Conflict"
+
+	// ServiceFailed means the service is invalid or the exposed port could not be bound
+	ServiceFailed ServiceState = "Failed"
+
+	// ServiceDenied means the service is not permitted by the operator's policy
+	ServiceDenied ServiceState = "Denied"
+
+	// ServiceRejected means the service was not applied because another service
+	// of an Atomic TSProxy could not be started
+	ServiceRejected ServiceState = "Rejected"
+
+	// ServiceUnresolved means the target of the service is missing,
+	// and the operator waits for it before exposing the port
+	ServiceUnresolved ServiceState = "Unresolved"
+)
+
+const (
+	// ConditionReady is set when every service of the TSProxy is active
+	ConditionReady = "Ready"
+
+	// ConditionTargetResolved is set when the Service, port or ready pods of every service exist
+	ConditionTargetResolved = "TargetResolved"
+)
+
+// TSProxyServiceStatus defines the observed state of a single proxied service
+type TSProxyServiceStatus struct {
+	// Name of the proxied service
+	Name string `json:"name"`
+
+	// ServicePort is the port on the service being proxied
+	ServicePort int32 `json:"port"`
+
+	// ExposeAs is the port exposed on the host network, either given in the spec or allocated
+	ExposeAs int32 `json:"exposeAs"`
+
+	//+optional
+	// Count is the number of consecutive ports exposed
+	Count int32 `json:"count,omitempty"`
+
+	// State of the service
+	State ServiceState `json:"state"`
+
+	//+optional
+	// Message explains why the service is not active
+	Message string `json:"message,omitempty"`
 }
 
 // TSProxyStatus defines the observed state of TSProxy
 type TSProxyStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	//+optional
+	// ObservedGeneration is the generation of the spec last applied
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	//+optional
+	// +listType=map
+	// +listMapKey=type
+	// Conditions of the TSProxy
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	//+optional
+	// Services contains the state of each service, in the order of the spec.
+	// When the operator runs per node it is the summary of the nodes.
+	Services []TSProxyServiceStatus `json:"services,omitempty"`
+
+	//+optional
+	// +listType=map
+	// +listMapKey=node
+	// Nodes contains the state of the services on each node, when the operator runs per node
+	Nodes []TSProxyNodeStatus `json:"nodes,omitempty"`
+}
+
+// TSProxyNodeStatus defines the observed state of the services on a single node
+type TSProxyNodeStatus struct {
+	// Node is the name of the node
+	Node string `json:"node"`
+
+	//+optional
+	// ObservedGeneration is the generation of the spec last applied on the node
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	//+optional
+	// Services contains the state of each service on the node, in the order of the spec
+	Services []TSProxyServiceStatus `json:"services,omitempty"`
+}
+
+// NodeServices merges the entries of the nodes that applied generation into one state per service,
+// or returns nil when no node has. A service is active when it is active on every node,
+// otherwise it has the state of the first node where it is not, with the node in the message.
+func (s *TSProxyStatus) NodeServices(generation int64) []TSProxyServiceStatus {
+	var result []TSProxyServiceStatus
+	for _, n := range s.Nodes {
+		if n.ObservedGeneration != generation {
+			continue
+		}
+		if result == nil {
+			result = make([]TSProxyServiceStatus, 0, len(n.Services))
+			for _, st := range n.Services {
+				if st.State != ServiceActive {
+					st.Message = n.Node + ": " + st.Message
+				}
+				result = append(result, st)
+			}
+			continue
+		}
+		for i := range result {
+			if i >= len(n.Services) || result[i].State != ServiceActive || n.Services[i].State == ServiceActive {
+				continue
+			}
+			result[i] = n.Services[i]
+			result[i].Message = n.Node + ": " + n.Services[i].Message
+		}
+	}
+	return result
 }
 
 //+kubebuilder:object:root=true
@@ -0,0 +1,72 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TSProxyGrantFrom is a namespace permitted to target services in the namespace of the grant
+type TSProxyGrantFrom struct {
+	//+required
+	// Namespace of the TSProxies permitted
+	Namespace string `json:"namespace"`
+}
+
+// TSProxyGrantTo is a service in the namespace of the grant that may be targeted
+type TSProxyGrantTo struct {
+	//+required
+	// Name of the service
+	Name string `json:"name"`
+}
+
+// TSProxyGrantSpec defines which TSProxies of other namespaces may target services in this namespace
+type TSProxyGrantSpec struct {
+	//+required
+	// +kubebuilder:validation:MinItems=1
+	// From lists the namespaces whose TSProxies may target services in this namespace
+	From []TSProxyGrantFrom `json:"from"`
+
+	//+optional
+	// To limits the services that may be targeted. When empty all services may be targeted.
+	// When set, services selecting pods by label are denied.
+	To []TSProxyGrantTo `json:"to,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// TSProxyGrant is the Schema for the tsproxygrants API.
+// It permits TSProxies in other namespaces to proxy services in its namespace.
+type TSProxyGrant struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec TSProxyGrantSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// TSProxyGrantList contains a list of TSProxyGrant
+type TSProxyGrantList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TSProxyGrant `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&TSProxyGrant{}, &TSProxyGrantList{})
+}
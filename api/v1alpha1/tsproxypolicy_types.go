@@ -0,0 +1,75 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PortRange is a single port or an inclusive range of ports, e.g. 40000-40099
+// +kubebuilder:validation:Pattern=`^[0-9]+(-[0-9]+)?$`
+type PortRange string
+
+// TSProxyPolicySpec defines which namespaces may use tsproxy and what they may expose
+type TSProxyPolicySpec struct {
+	//+required
+	// NamespaceSelector selects the namespaces this policy applies to.
+	// An empty selector selects all namespaces.
+	NamespaceSelector metav1.LabelSelector `json:"namespaceSelector"`
+
+	//+optional
+	// AllowedPorts lists the exposeAs ports and ranges (e.g. 40000-40099) the namespaces may claim.
+	// When empty all ports allowed by the operator may be claimed.
+	AllowedPorts []PortRange `json:"allowedPorts,omitempty"`
+
+	//+optional
+	// +kubebuilder:validation:Minimum=0
+	// MaxPorts limits the number of exposed ports in each namespace.
+	// The services of all TSProxies in the namespace count, and the oldest TSProxies claim their ports first.
+	MaxPorts *int32 `json:"maxPorts,omitempty"`
+
+	//+optional
+	// +kubebuilder:validation:Minimum=0
+	// MaxServices limits the number of proxied services in each namespace.
+	// The services of all TSProxies in the namespace count, and the oldest TSProxies claim them first.
+	MaxServices *int32 `json:"maxServices,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// TSProxyPolicy is the Schema for the tsproxypolicies API.
+// When several policies select a namespace, the one with the lowest name applies.
+type TSProxyPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec TSProxyPolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// TSProxyPolicyList contains a list of TSProxyPolicy
+type TSProxyPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TSProxyPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&TSProxyPolicy{}, &TSProxyPolicyList{})
+}
@@ -21,6 +21,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -30,7 +31,7 @@ func (in *TSProxy) DeepCopyInto(out *TSProxy) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TSProxy.
@@ -51,6 +52,159 @@ func (in *TSProxy) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TSProxyBandwidth) DeepCopyInto(out *TSProxyBandwidth) {
+	*out = *in
+	if in.PerConnection != nil {
+		in, out := &in.PerConnection, &out.PerConnection
+		*out = new(TSProxyRate)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PerListener != nil {
+		in, out := &in.PerListener, &out.PerListener
+		*out = new(TSProxyRate)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TSProxyBandwidth.
+func (in *TSProxyBandwidth) DeepCopy() *TSProxyBandwidth {
+	if in == nil {
+		return nil
+	}
+	out := new(TSProxyBandwidth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TSProxyClientLimits) DeepCopyInto(out *TSProxyClientLimits) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TSProxyClientLimits.
+func (in *TSProxyClientLimits) DeepCopy() *TSProxyClientLimits {
+	if in == nil {
+		return nil
+	}
+	out := new(TSProxyClientLimits)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TSProxyGrant) DeepCopyInto(out *TSProxyGrant) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TSProxyGrant.
+func (in *TSProxyGrant) DeepCopy() *TSProxyGrant {
+	if in == nil {
+		return nil
+	}
+	out := new(TSProxyGrant)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TSProxyGrant) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TSProxyGrantFrom) DeepCopyInto(out *TSProxyGrantFrom) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TSProxyGrantFrom.
+func (in *TSProxyGrantFrom) DeepCopy() *TSProxyGrantFrom {
+	if in == nil {
+		return nil
+	}
+	out := new(TSProxyGrantFrom)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TSProxyGrantList) DeepCopyInto(out *TSProxyGrantList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]TSProxyGrant, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TSProxyGrantList.
+func (in *TSProxyGrantList) DeepCopy() *TSProxyGrantList {
+	if in == nil {
+		return nil
+	}
+	out := new(TSProxyGrantList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TSProxyGrantList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TSProxyGrantSpec) DeepCopyInto(out *TSProxyGrantSpec) {
+	*out = *in
+	if in.From != nil {
+		in, out := &in.From, &out.From
+		*out = make([]TSProxyGrantFrom, len(*in))
+		copy(*out, *in)
+	}
+	if in.To != nil {
+		in, out := &in.To, &out.To
+		*out = make([]TSProxyGrantTo, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TSProxyGrantSpec.
+func (in *TSProxyGrantSpec) DeepCopy() *TSProxyGrantSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TSProxyGrantSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TSProxyGrantTo) DeepCopyInto(out *TSProxyGrantTo) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TSProxyGrantTo.
+func (in *TSProxyGrantTo) DeepCopy() *TSProxyGrantTo {
+	if in == nil {
+		return nil
+	}
+	out := new(TSProxyGrantTo)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TSProxyList) DeepCopyInto(out *TSProxyList) {
 	*out = *in
@@ -83,9 +237,158 @@ func (in *TSProxyList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TSProxyNodeStatus) DeepCopyInto(out *TSProxyNodeStatus) {
+	*out = *in
+	if in.Services != nil {
+		in, out := &in.Services, &out.Services
+		*out = make([]TSProxyServiceStatus, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TSProxyNodeStatus.
+func (in *TSProxyNodeStatus) DeepCopy() *TSProxyNodeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TSProxyNodeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TSProxyPolicy) DeepCopyInto(out *TSProxyPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TSProxyPolicy.
+func (in *TSProxyPolicy) DeepCopy() *TSProxyPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(TSProxyPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TSProxyPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TSProxyPolicyList) DeepCopyInto(out *TSProxyPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]TSProxyPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TSProxyPolicyList.
+func (in *TSProxyPolicyList) DeepCopy() *TSProxyPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(TSProxyPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *TSProxyPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TSProxyPolicySpec) DeepCopyInto(out *TSProxyPolicySpec) {
+	*out = *in
+	in.NamespaceSelector.DeepCopyInto(&out.NamespaceSelector)
+	if in.AllowedPorts != nil {
+		in, out := &in.AllowedPorts, &out.AllowedPorts
+		*out = make([]PortRange, len(*in))
+		copy(*out, *in)
+	}
+	if in.MaxPorts != nil {
+		in, out := &in.MaxPorts, &out.MaxPorts
+		*out = new(int32)
+		**out = **in
+	}
+	if in.MaxServices != nil {
+		in, out := &in.MaxServices, &out.MaxServices
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TSProxyPolicySpec.
+func (in *TSProxyPolicySpec) DeepCopy() *TSProxyPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TSProxyPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TSProxyRate) DeepCopyInto(out *TSProxyRate) {
+	*out = *in
+	if in.Upload != nil {
+		in, out := &in.Upload, &out.Upload
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Download != nil {
+		in, out := &in.Download, &out.Download
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TSProxyRate.
+func (in *TSProxyRate) DeepCopy() *TSProxyRate {
+	if in == nil {
+		return nil
+	}
+	out := new(TSProxyRate)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TSProxyService) DeepCopyInto(out *TSProxyService) {
 	*out = *in
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Bandwidth != nil {
+		in, out := &in.Bandwidth, &out.Bandwidth
+		*out = new(TSProxyBandwidth)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ClientLimits != nil {
+		in, out := &in.ClientLimits, &out.ClientLimits
+		*out = new(TSProxyClientLimits)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TSProxyService.
@@ -98,12 +401,39 @@ func (in *TSProxyService) DeepCopy() *TSProxyService {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TSProxyServiceStatus) DeepCopyInto(out *TSProxyServiceStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TSProxyServiceStatus.
+func (in *TSProxyServiceStatus) DeepCopy() *TSProxyServiceStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TSProxyServiceStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TSProxySpec) DeepCopyInto(out *TSProxySpec) {
 	*out = *in
 	if in.Services != nil {
 		in, out := &in.Services, &out.Services
 		*out = make([]TSProxyService, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]TSProxyToleration, len(*in))
 		copy(*out, *in)
 	}
 }
@@ -121,6 +451,25 @@ func (in *TSProxySpec) DeepCopy() *TSProxySpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TSProxyStatus) DeepCopyInto(out *TSProxyStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Services != nil {
+		in, out := &in.Services, &out.Services
+		*out = make([]TSProxyServiceStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Nodes != nil {
+		in, out := &in.Nodes, &out.Nodes
+		*out = make([]TSProxyNodeStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TSProxyStatus.
@@ -132,3 +481,18 @@ func (in *TSProxyStatus) DeepCopy() *TSProxyStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TSProxyToleration) DeepCopyInto(out *TSProxyToleration) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TSProxyToleration.
+func (in *TSProxyToleration) DeepCopy() *TSProxyToleration {
+	if in == nil {
+		return nil
+	}
+	out := new(TSProxyToleration)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/AB-Lindex/tsproxy/internal/admin/api"
+)
+
+// runConnections prints the live connections of a TSProxy, asking the admin API of every operator pod
+// through the API server proxy
+func runConnections(ctx context.Context, k *kube, args []string) error {
+	fs := flag.NewFlagSet("connections", flag.ContinueOnError)
+	operatorNamespace := fs.String("operator-namespace", "tsproxy-system", "Namespace of the operator")
+	selector := fs.String("selector", "control-plane=controller-manager", "Label selector of the operator pods")
+	adminPort := fs.Int("admin-port", 8082, "Port of the operator's admin API (--admin-bind-address)")
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("connections needs the name of a TSProxy")
+	}
+
+	pods, err := k.clientset.CoreV1().Pods(*operatorNamespace).List(ctx, metav1.ListOptions{LabelSelector: *selector})
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "POD\tSERVICE\tEXPOSEAS\tID\tCLIENT\tBACKEND\tAGE\tIN\tOUT\tIDLE")
+	queried := 0
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+
+		path := "/api/v1/tsproxies/" + k.namespace + "/" + positional[0]
+		data, err := k.clientset.CoreV1().Pods(pod.Namespace).
+			ProxyGet("http", pod.Name, strconv.Itoa(*adminPort), path, nil).DoRaw(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", pod.Name, err)
+			continue
+		}
+		queried++
+
+		var info api.TSProxyInfo
+		if err := json.Unmarshal(data, &info); err != nil {
+			return fmt.Errorf("%s: %w", pod.Name, err)
+		}
+		for _, svc := range info.Services {
+			for _, c := range svc.Connections {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\t%s\t%d\t%d\t%s\n",
+					pod.Name, svc.Name, svc.ExposeAs, c.ID, c.Client, c.Backend,
+					time.Since(c.Started).Round(time.Second), c.BytesIn, c.BytesOut,
+					time.Duration(c.Idle*float64(time.Second)).Round(time.Second))
+			}
+		}
+	}
+	if queried == 0 {
+		return fmt.Errorf("no operator pod answered in namespace %s", *operatorNamespace)
+	}
+	return w.Flush()
+}
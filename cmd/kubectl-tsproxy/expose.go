@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+)
+
+// runExpose adds a service to a TSProxy, creating the TSProxy when it does not exist
+func runExpose(ctx context.Context, k *kube, args []string) error {
+	fs := flag.NewFlagSet("expose", flag.ContinueOnError)
+	port := fs.Int("port", 0, "Port on the service to proxy")
+	exposeAs := fs.Int("as", 0, "Host port to expose the service on, allocated by the operator when omitted")
+	count := fs.Int("count", 0, "Number of consecutive ports to expose")
+	name := fs.String("name", "", "Name of the TSProxy, defaults to the name of the service")
+	serviceNamespace := fs.String("service-namespace", "", "Namespace of the service, when it is not the namespace of the TSProxy")
+	class := fs.String("class", "", "proxyClassName of the TSProxy, when it is created")
+
+	positional, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errors.New("expose needs exactly one service, e.g. svc/postgres")
+	}
+	kind, service, found := strings.Cut(positional[0], "/")
+	if !found {
+		kind, service = "svc", positional[0]
+	}
+	if kind != "svc" && kind != "service" && kind != "services" {
+		return fmt.Errorf("only services can be exposed, not %q", kind)
+	}
+	if *port == 0 {
+		return errors.New("--port is required")
+	}
+	if *name == "" {
+		*name = service
+	}
+
+	svc := proxyv1alpha1.TSProxyService{
+		Name:        service,
+		Namespace:   *serviceNamespace,
+		ServicePort: int32(*port),
+		ExposeAs:    int32(*exposeAs),
+		Count:       int32(*count),
+	}
+
+	var obj proxyv1alpha1.TSProxy
+	err = k.client.Get(ctx, client.ObjectKey{Namespace: k.namespace, Name: *name}, &obj)
+	switch {
+	case apierrors.IsNotFound(err):
+		obj.Namespace, obj.Name = k.namespace, *name
+		obj.Spec.ProxyClassName = *class
+		obj.Spec.Services = []proxyv1alpha1.TSProxyService{svc}
+		if err := k.client.Create(ctx, &obj); err != nil {
+			return err
+		}
+		fmt.Printf("tsproxy/%s created\n", obj.Name)
+		return nil
+	case err != nil:
+		return err
+	}
+
+	replaced := false
+	for i, existing := range obj.Spec.Services {
+		if existing.Name == svc.Name && existing.Namespace == svc.Namespace && existing.ServicePort == svc.ServicePort {
+			obj.Spec.Services[i] = svc
+			replaced = true
+		}
+	}
+	if !replaced {
+		obj.Spec.Services = append(obj.Spec.Services, svc)
+	}
+	if err := k.client.Update(ctx, &obj); err != nil {
+		return err
+	}
+	fmt.Printf("tsproxy/%s configured\n", obj.Name)
+	return nil
+}
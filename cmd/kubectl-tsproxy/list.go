@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+)
+
+// portEntry is a service of a TSProxy, as reported in its status when available
+type portEntry struct {
+	namespace string
+	tsproxy   string
+	service   string
+	port      string
+	exposeAs  int32
+	count     int32
+	state     string
+	message   string
+}
+
+func (e *portEntry) exposed() string {
+	if e.exposeAs == 0 {
+		return "-"
+	}
+	if e.count > 1 {
+		return fmt.Sprintf("%d-%d", e.exposeAs, e.exposeAs+e.count-1)
+	}
+	return fmt.Sprint(e.exposeAs)
+}
+
+// listEntries returns the services of all TSProxies, or those in namespace, sorted by exposed port
+func listEntries(ctx context.Context, k *kube, namespace string) ([]portEntry, error) {
+	var list proxyv1alpha1.TSProxyList
+	if err := k.client.List(ctx, &list, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+
+	var entries []portEntry
+	for _, obj := range list.Items {
+		services := obj.Status.Services
+		if len(obj.Status.Nodes) > 0 {
+			services = nodeServices(&obj)
+		}
+		for i, svc := range obj.Spec.Services {
+			e := portEntry{
+				namespace: obj.Namespace,
+				tsproxy:   obj.Name,
+				service:   svc.Name,
+				port:      fmt.Sprint(svc.ServicePort),
+				exposeAs:  svc.ExposeAs,
+				count:     svc.PortCount(),
+				state:     "Pending",
+			}
+			switch {
+			case svc.Host != "":
+				e.service = svc.Name + " (" + svc.Host + ")"
+			case svc.Namespace != "":
+				e.service = svc.Namespace + "/" + svc.Name
+			}
+			if svc.PortName != "" {
+				e.port = svc.PortName
+			}
+			if i < len(services) && services[i].Name == svc.Name {
+				st := services[i]
+				e.exposeAs, e.state, e.message = st.ExposeAs, string(st.State), st.Message
+			}
+			entries = append(entries, e)
+		}
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].exposeAs != entries[j].exposeAs {
+			return entries[i].exposeAs < entries[j].exposeAs
+		}
+		return entries[i].namespace+"/"+entries[i].tsproxy < entries[j].namespace+"/"+entries[j].tsproxy
+	})
+	return entries, nil
+}
+
+// nodeServices returns the states of the services of obj merged from its nodes,
+// with the ports of the summary written by the operator when they match
+func nodeServices(obj *proxyv1alpha1.TSProxy) []proxyv1alpha1.TSProxyServiceStatus {
+	services := obj.Status.NodeServices(obj.Generation)
+	for i := range services {
+		if i < len(obj.Status.Services) && obj.Status.Services[i].Name == services[i].Name {
+			services[i].ExposeAs = obj.Status.Services[i].ExposeAs
+		}
+	}
+	return services
+}
+
+// runList prints the port map of the cluster, or of the namespace unless -A is given
+func runList(ctx context.Context, k *kube, args []string) error {
+	fs := flag.NewFlagSet("ls", flag.ContinueOnError)
+	all := fs.Bool("A", false, "List the TSProxies in all namespaces")
+	if _, err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	namespace := k.namespace
+	if *all {
+		namespace = ""
+	}
+	entries, err := listEntries(ctx, k, namespace)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "EXPOSEAS\tNAMESPACE\tTSPROXY\tSERVICE\tPORT\tSTATE\tMESSAGE")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.exposed(), e.namespace, e.tsproxy, e.service, e.port, e.state, e.message)
+	}
+	return w.Flush()
+}
+
+// runConflicts prints the ports claimed by more than one TSProxy, with the TSProxy holding each of them
+func runConflicts(ctx context.Context, k *kube, args []string) error {
+	if len(args) > 0 {
+		return errors.New("conflicts takes no arguments")
+	}
+	entries, err := listEntries(ctx, k, "")
+	if err != nil {
+		return err
+	}
+
+	var claims = make(map[int32][]*portEntry)
+	for i := range entries {
+		e := &entries[i]
+		for port := e.exposeAs; e.exposeAs != 0 && port < e.exposeAs+e.count; port++ {
+			claims[port] = append(claims[port], e)
+		}
+	}
+
+	var ports []int32
+	for port, claimed := range claims {
+		if len(claimed) > 1 {
+			ports = append(ports, port)
+		}
+	}
+	if len(ports) == 0 {
+		fmt.Println("No conflicts")
+		return nil
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i] < ports[j] })
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PORT\tHOLDER\tCLAIMED BY")
+	for _, port := range ports {
+		holder, others := "-", []string{}
+		for _, c := range claims[port] {
+			name := c.namespace + "/" + c.tsproxy
+			if c.state == string(proxyv1alpha1.ServiceActive) {
+				holder = name
+			} else {
+				others = append(others, name+" ("+c.state+")")
+			}
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", port, holder, strings.Join(others, ", "))
+	}
+	return w.Flush()
+}
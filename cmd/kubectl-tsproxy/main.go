@@ -0,0 +1,136 @@
+// kubectl-tsproxy inspects and manages TSProxies, installed as a kubectl plugin:
+//
+//	kubectl tsproxy expose svc/postgres --port 5432 --as 40001
+//	kubectl tsproxy ls
+//	kubectl tsproxy conflicts
+//	kubectl tsproxy connections postgres
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(proxyv1alpha1.AddToScheme(scheme))
+}
+
+// command is a subcommand, parsing its own flags from args
+type command struct {
+	usage string
+	run   func(ctx context.Context, k *kube, args []string) error
+}
+
+var commands = map[string]command{
+	"expose":      {"expose svc/NAME --port PORT [--as EXPOSEAS] [--count N] [--name TSPROXY] [--service-namespace NS]", runExpose},
+	"ls":          {"ls [-A]", runList},
+	"conflicts":   {"conflicts", runConflicts},
+	"connections": {"connections TSPROXY [--operator-namespace NS] [--admin-port PORT]", runConnections},
+}
+
+// kube holds the clients and the namespace selected on the command line
+type kube struct {
+	client    client.Client
+	clientset *kubernetes.Clientset
+	namespace string
+}
+
+func main() {
+	global := flag.NewFlagSet("kubectl-tsproxy", flag.ExitOnError)
+	kubeconfig := global.String("kubeconfig", "", "Path to the kubeconfig file")
+	kubecontext := global.String("context", "", "The kubeconfig context to use")
+	namespace := global.String("namespace", "", "The namespace, defaults to the namespace of the context")
+	global.StringVar(namespace, "n", "", "Shorthand for --namespace")
+	global.Usage = usage(global)
+	_ = global.Parse(os.Args[1:])
+
+	if global.NArg() == 0 {
+		global.Usage()
+		os.Exit(2)
+	}
+	cmd, found := commands[global.Arg(0)]
+	if !found {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", global.Arg(0))
+		global.Usage()
+		os.Exit(2)
+	}
+
+	k, err := connect(*kubeconfig, *kubecontext, *namespace)
+	if err == nil {
+		err = cmd.run(context.Background(), k, global.Args()[1:])
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func usage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintln(os.Stderr, "Usage: kubectl tsproxy [-n NAMESPACE] COMMAND [flags]")
+		fmt.Fprintln(os.Stderr, "\nCommands:")
+		for _, name := range []string{"expose", "ls", "conflicts", "connections"} {
+			fmt.Fprintln(os.Stderr, "  "+commands[name].usage)
+		}
+		fmt.Fprintln(os.Stderr, "\nGlobal flags:")
+		fs.PrintDefaults()
+	}
+}
+
+// connect loads the kubeconfig like kubectl does
+func connect(kubeconfig, kubecontext, namespace string) (*kube, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules,
+		&clientcmd.ConfigOverrides{CurrentContext: kubecontext})
+
+	config, err := loader.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	if namespace == "" {
+		if namespace, _, err = loader.Namespace(); err != nil {
+			return nil, err
+		}
+	}
+
+	c, err := client.New(config, client.Options{Scheme: scheme})
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kube{client: c, clientset: clientset, namespace: namespace}, nil
+}
+
+// parseFlags parses args of a subcommand, allowing flags after the positional arguments
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
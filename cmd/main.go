@@ -17,25 +17,39 @@ limitations under the License.
 package main
 
 import (
+	"cmp"
+	"context"
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"github.com/rs/zerolog"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+	"github.com/AB-Lindex/tsproxy/internal/accesslog"
+	"github.com/AB-Lindex/tsproxy/internal/admin"
 	"github.com/AB-Lindex/tsproxy/internal/controller"
 	"github.com/AB-Lindex/tsproxy/internal/loggr"
 	"github.com/AB-Lindex/tsproxy/internal/options"
+	webhookv1alpha1 "github.com/AB-Lindex/tsproxy/internal/webhook/v1alpha1"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -59,6 +73,84 @@ func main() {
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&options.Flags.Debug, "debug", false, "Enable debug logging")
 	flag.BoolVar(&options.Flags.Keepalive, "keepalive", true, "Enable TCP Keepalive on connections")
+	flag.DurationVar(&options.Flags.HalfCloseTimeout, "half-close-timeout", 30*time.Second,
+		"How long the other direction of a connection may be idle after the client or backend closed its write side, "+
+			"before the connection is closed. Zero closes both directions at once")
+	flag.StringVar(&options.Flags.LogFormat, "log-format", "auto",
+		"Format of the log: json, console, logfmt, or auto for console on a terminal and json otherwise")
+	flag.StringVar(&options.Flags.LogOutput, "log-output", "stdout",
+		"Where the log is written: stdout, stderr, syslog, syslog:<socket path> or a file path")
+	flag.IntVar(&options.Flags.LogMaxSize, "log-max-size", 100,
+		"Size in megabytes at which the log file is rotated. Zero never rotates")
+	flag.IntVar(&options.Flags.LogMaxBackups, "log-max-backups", 5,
+		"Number of rotated log files kept")
+	flag.DurationVar(&options.Flags.LogMaxAge, "log-max-age", 0,
+		"Remove rotated log files older than this (e.g. 168h). Default keeps them")
+	flag.StringVar(&options.Flags.LogTimeFormat, "log-time-format", "",
+		"Format of the log timestamps: rfc3339nano, rfc3339, unix, unixms, unixmicro, unixnano or a Go time layout. "+
+			"Default is rfc3339nano, or unixms shown as the time of day on the console")
+	flag.StringVar(&options.Flags.LogFieldNames, "log-field-names", "",
+		"Comma separated renames of the standard log fields timestamp, level, message, error, caller and logger "+
+			"(e.g. timestamp=time,message=msg). Default uses ts, level, message, error, caller and logger")
+	flag.StringVar(&options.Flags.AccessLog, "access-log", "none",
+		"Where a JSON record of each closed or rejected connection is written: stdout, stderr, none or a file path. "+
+			"Written regardless of the log level")
+	flag.IntVar(&options.Flags.AccessLogMaxSize, "access-log-max-size", 100,
+		"Size in megabytes at which the access log file is rotated. Zero never rotates")
+	flag.IntVar(&options.Flags.AccessLogMaxBackups, "access-log-max-backups", 5,
+		"Number of rotated access log files kept")
+	flag.Var(&options.Flags.PortRange, "port-range",
+		"Range of host ports (e.g. 40000-40999) allocated to services without exposeAs")
+	flag.Var(&options.Flags.AllowedPorts, "allowed-ports",
+		"Comma separated host ports and ranges that may be exposed (e.g. 40000-49999). Default allows all")
+	flag.Var(&options.Flags.ReservedPorts, "reserved-ports",
+		"Comma separated host ports and ranges that may never be exposed (e.g. 22,10250,30000-32767)")
+	flag.Var(&options.Flags.AllowedExternal, "allowed-external",
+		"Comma separated external hosts, wildcard domains and networks, optionally with ports "+
+			"(e.g. db.example.com:5432,*.corp.example.com,10.20.0.0/16), that services and ExternalName Services may target. "+
+			"Default allows none")
+	flag.BoolVar(&options.Flags.WaitForTarget, "wait-for-target", false,
+		"Do not expose the ports of services whose Service, port or ready pods are missing, "+
+			"so clients get connection refused instead of a reset")
+	flag.IntVar(&options.Flags.ClientTableSize, "client-table-size", 10000,
+		"Number of client IPs tracked per listener for the clientLimits of a service. "+
+			"When all tracked clients have open connections, connections from new clients are rejected")
+	flag.BoolVar(&options.Flags.EnforcePolicies, "enforce-policies", false,
+		"Only allow TSProxies in namespaces selected by a TSProxyPolicy, within its port ranges and quotas")
+	flag.Func("watch-namespaces",
+		"Comma separated namespaces to watch for TSProxies, only these need RBAC permissions. Default watches all. "+
+			"Services, pods and grants in other namespaces targeted by a TSProxy are read directly from the API server, "+
+			"needing RBAC permissions there, and their changes are picked up within 30s",
+		func(s string) error {
+			for _, ns := range strings.Split(s, ",") {
+				if ns = strings.TrimSpace(ns); ns != "" {
+					options.Flags.WatchNamespaces = append(options.Flags.WatchNamespaces, ns)
+				}
+			}
+			return nil
+		})
+	flag.StringVar(&options.Flags.WatchNamespaceSelector, "watch-namespace-selector", "",
+		"Label selector (e.g. env=staging) of the namespaces whose TSProxies are handled, resolved at startup "+
+			"to limit the cache. Namespaces labelled later are handled after a restart")
+	flag.BoolVar(&options.Flags.EnableWebhooks, "enable-webhooks", false,
+		"Enable the admission webhook validating TSProxies against the allowed and reserved ports")
+	flag.StringVar(&options.Flags.AdminAddr, "admin-bind-address", cmp.Or(os.Getenv("ADMIN_BIND_ADDRESS"), "0"),
+		"The address the admin API listing listeners and live connections binds to. "+
+			"Defaults to the ADMIN_BIND_ADDRESS environment variable, and is disabled when that is unset")
+	flag.StringVar(&options.Flags.AdminTokenFile, "admin-token-file", "",
+		"File with the bearer token required to terminate connections through the admin API. Default disables these actions")
+	flag.StringVar(&options.Flags.ProxyClass, "proxy-class", "",
+		"Only handle TSProxies with this proxyClassName, to run several deployments in one cluster. "+
+			"Default handles TSProxies without a proxyClassName")
+	flag.BoolVar(&options.Flags.DefaultClass, "default-class", false,
+		"Also handle TSProxies without a proxyClassName when --proxy-class is set")
+	flag.StringVar(&options.Flags.NodeName, "node-name", os.Getenv("NODE_NAME"),
+		"Name of the node this instance runs on, when running one instance per node. "+
+			"Only TSProxies whose nodeSelector and tolerations match the node are exposed, with status reported per node. "+
+			"Defaults to the NODE_NAME environment variable")
+	flag.StringVar(&options.Flags.ConfigFile, "config-file", "",
+		"Run standalone from the TSProxy documents in this YAML file, reloaded when it changes, "+
+			"instead of the Kubernetes API. External hosts in the file are not checked against --allowed-external")
 	// flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 	// 	"Enable leader election for controller manager. "+
 	// 		"Enabling this will ensure there is only one active controller manager.")
@@ -68,11 +160,64 @@ func main() {
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
+	if err := loggr.Configure(); err != nil {
+		fmt.Fprintln(os.Stderr, "unable to configure the log:", err)
+		os.Exit(1)
+	}
+	if options.Flags.Debug {
+		loggr.SetLevel(zerolog.DebugLevel)
+	}
+	if level := flag.Lookup("zap-log-level").Value.String(); level != "" {
+		// already validated by the flag
+		parsed, _ := loggr.ParseLevel(level)
+		loggr.SetLevel(parsed)
+	}
 	logger := zap.New(zap.UseFlagOptions(&opts)).WithSink(loggr.New())
 	ctrl.SetLogger(logger)
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	if err := accesslog.Open(); err != nil {
+		setupLog.Error(err, "unable to open access log", "path", options.Flags.AccessLog)
+		os.Exit(1)
+	}
+
+	if options.Flags.ConfigFile != "" {
+		if err := runStandalone(ctrl.SetupSignalHandler(), metricsAddr); err != nil {
+			setupLog.Error(err, "problem running standalone", "path", options.Flags.ConfigFile)
+			os.Exit(1)
+		}
+		return
+	}
+
+	config := ctrl.GetConfigOrDie()
+	var cacheOpts cache.Options
+	if options.Flags.WatchNamespaceSelector != "" {
+		// the cache is limited to the namespaces selected now
+		c, err := client.New(config, client.Options{Scheme: scheme})
+		if err == nil {
+			options.Flags.WatchNamespaces, err = controller.WatchedNamespaces(context.Background(), c)
+		}
+		if err != nil {
+			setupLog.Error(err, "unable to resolve watched namespaces", "selector", options.Flags.WatchNamespaceSelector)
+			os.Exit(1)
+		}
+		setupLog.Info("watching namespaces", "namespaces", options.Flags.WatchNamespaces)
+	}
+	if len(options.Flags.WatchNamespaces) > 0 {
+		cacheOpts.DefaultNamespaces = make(map[string]cache.Config)
+		for _, ns := range options.Flags.WatchNamespaces {
+			cacheOpts.DefaultNamespaces[ns] = cache.Config{}
+		}
+	}
+	if options.Flags.NodeName != "" {
+		// only our own node is watched
+		cacheOpts.ByObject = map[client.Object]cache.ByObject{
+			&corev1.Node{}: {Field: fields.OneTermEqualSelector("metadata.name", options.Flags.NodeName)},
+		}
+	}
+
+	mgr, err := ctrl.NewManager(config, ctrl.Options{
 		Scheme:                 scheme,
+		Cache:                  cacheOpts,
 		Metrics:                metricsserver.Options{BindAddress: metricsAddr},
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         false,
@@ -95,14 +240,30 @@ func main() {
 	}
 
 	if err = (&controller.TSProxyReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:    mgr.GetClient(),
+		Scheme:    mgr.GetScheme(),
+		APIReader: mgr.GetAPIReader(),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "TSProxy")
 		os.Exit(1)
 	}
+	if options.Flags.EnableWebhooks {
+		if err = webhookv1alpha1.SetupTSProxyWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "TSProxy")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
+	if options.Flags.AdminAddr != "" && options.Flags.AdminAddr != "0" {
+		if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+			return admin.Run(ctx, options.Flags.AdminAddr)
+		})); err != nil {
+			setupLog.Error(err, "unable to set up admin API")
+			os.Exit(1)
+		}
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
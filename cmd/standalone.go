@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/AB-Lindex/tsproxy/internal/admin"
+	"github.com/AB-Lindex/tsproxy/internal/options"
+	"github.com/AB-Lindex/tsproxy/internal/standalone"
+)
+
+// runStandalone serves the TSProxies of the config file and their metrics until ctx is done
+func runStandalone(ctx context.Context, metricsAddr string) error {
+	ctx = ctrl.LoggerInto(ctx, ctrl.Log.WithName("standalone"))
+
+	if metricsAddr != "" && metricsAddr != "0" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{}))
+		server := &http.Server{Addr: metricsAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+		go func() {
+			setupLog.Info("serving metrics", "address", metricsAddr)
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				setupLog.Error(err, "problem serving metrics")
+			}
+		}()
+		defer server.Close()
+	}
+
+	if options.Flags.AdminAddr != "" && options.Flags.AdminAddr != "0" {
+		go func() {
+			if err := admin.Run(ctx, options.Flags.AdminAddr); err != nil {
+				setupLog.Error(err, "problem serving admin API")
+			}
+		}()
+	}
+
+	setupLog.Info("starting standalone", "path", options.Flags.ConfigFile)
+	return standalone.Run(ctx, options.Flags.ConfigFile)
+}
@@ -0,0 +1,71 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/AB-Lindex/tsproxy/internal/logfile"
+	"github.com/AB-Lindex/tsproxy/internal/options"
+)
+
+// Record describes a proxied connection, written once when it is closed or rejected
+type Record struct {
+	Time     time.Time `json:"time"`
+	TSProxy  string    `json:"tsproxy"`
+	Listener string    `json:"listener"`
+	Port     int       `json:"port"`
+	Client   string    `json:"client"`
+	Backend  string    `json:"backend"`
+	Start    time.Time `json:"start"`
+	Duration float64   `json:"durationSeconds"`
+	BytesIn  int64     `json:"bytesIn"`
+	BytesOut int64     `json:"bytesOut"`
+	Reason   string    `json:"reason"`
+	Error    string    `json:"error,omitempty"`
+}
+
+var sink struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+// Open sets up the sink given by --access-log: stdout, stderr, a file rotated by size, or none by default
+func Open() error {
+	var w io.Writer
+	switch options.Flags.AccessLog {
+	case "", "none":
+	case "stdout":
+		w = os.Stdout
+	case "stderr":
+		w = os.Stderr
+	default:
+		f, err := logfile.Open(options.Flags.AccessLog, int64(options.Flags.AccessLogMaxSize)<<20, options.Flags.AccessLogMaxBackups, 0)
+		if err != nil {
+			return err
+		}
+		w = f
+	}
+
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	sink.w = w
+	return nil
+}
+
+// Write writes r as a JSON line to the sink, regardless of the log level
+func Write(r *Record) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	if sink.w == nil {
+		return
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+	_, _ = sink.w.Write(append(data, '\n'))
+}
@@ -0,0 +1,137 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/AB-Lindex/tsproxy/internal/metrics"
+	"github.com/AB-Lindex/tsproxy/internal/options"
+	"github.com/AB-Lindex/tsproxy/internal/proxy"
+)
+
+// authorized wraps an admin action, requiring the bearer token from options.Flags.AdminTokenFile.
+// The file is read on every request, so a mounted Secret can be rotated.
+// Actions are refused when no token file is configured.
+func authorized(action string, next func(http.ResponseWriter, *http.Request) (int, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := log.FromContext(r.Context()).WithValues("action", action, "remote", r.RemoteAddr, "path", r.URL.Path)
+
+		if options.Flags.AdminTokenFile == "" {
+			logger.Info("Admin action refused - no token configured")
+			metrics.AdminAction(action, "forbidden", 0)
+			writeError(w, http.StatusForbidden, "admin actions are disabled")
+			return
+		}
+		token, err := os.ReadFile(options.Flags.AdminTokenFile)
+		if err != nil {
+			logger.Error(err, "Unable to read admin token")
+			metrics.AdminAction(action, "error", 0)
+			writeError(w, http.StatusInternalServerError, "unable to read admin token")
+			return
+		}
+
+		given, bearer := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		expected := strings.TrimSpace(string(token))
+		if !bearer || expected == "" || subtle.ConstantTimeCompare([]byte(given), []byte(expected)) != 1 {
+			logger.Info("Admin action refused - unauthorized")
+			metrics.AdminAction(action, "unauthorized", 0)
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		closed, err := next(w, r.WithContext(log.IntoContext(r.Context(), logger)))
+		if errors.Is(err, errPending) {
+			// counted by the action when it is done
+			logger.Info("Admin action started", "connections", closed)
+			return
+		}
+		if err != nil {
+			logger.Info("Admin action failed", "error", err.Error())
+			metrics.AdminAction(action, "failed", 0)
+			return
+		}
+		logger.Info("Admin action", "terminated", closed)
+		metrics.AdminAction(action, "ok", closed)
+	}
+}
+
+// errPending is returned by an action that goes on after the response, and counts itself when done
+var errPending = errors.New("pending")
+
+// actionError is returned by an action that already wrote its error response
+type actionError string
+
+func (e actionError) Error() string {
+	return string(e)
+}
+
+func fail(w http.ResponseWriter, status int, message string) (int, error) {
+	writeError(w, status, message)
+	return 0, actionError(message)
+}
+
+// closeListenerAction is the name of closeListenerConnections in the log and metrics
+const closeListenerAction = "close-listener"
+
+// closeConnection terminates a connection by its ID
+func closeConnection(w http.ResponseWriter, r *http.Request) (int, error) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return fail(w, http.StatusBadRequest, "invalid connection id")
+	}
+	if !proxy.CloseConnection(r.Context(), id) {
+		return fail(w, http.StatusNotFound, "connection not found")
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"terminated": 1})
+	return 1, nil
+}
+
+// closeConnectionsFrom terminates all connections from the client IP in the source query parameter
+func closeConnectionsFrom(w http.ResponseWriter, r *http.Request) (int, error) {
+	ip := net.ParseIP(r.URL.Query().Get("source"))
+	if ip == nil {
+		return fail(w, http.StatusBadRequest, "source must be an IP address")
+	}
+	closed := proxy.CloseConnectionsFrom(r.Context(), ip)
+	writeJSON(w, http.StatusOK, map[string]int{"terminated": closed})
+	return closed, nil
+}
+
+// closeListenerConnections terminates all connections of the listener on a port.
+// With the grace period in the grace query parameter (e.g. 30s) the listener drains:
+// it closes new connections during grace and terminates those still open after it.
+func closeListenerConnections(w http.ResponseWriter, r *http.Request) (int, error) {
+	port, err := strconv.ParseInt(r.PathValue("port"), 10, 32)
+	if err != nil {
+		return fail(w, http.StatusBadRequest, "invalid port")
+	}
+	var grace time.Duration
+	if s := r.URL.Query().Get("grace"); s != "" {
+		if grace, err = time.ParseDuration(s); err != nil || grace < 0 {
+			return fail(w, http.StatusBadRequest, "invalid grace period")
+		}
+	}
+
+	logger := log.FromContext(r.Context())
+	closed, found := proxy.CloseListenerConnections(r.Context(), int32(port), grace, func(terminated int) {
+		logger.Info("Admin action", "terminated", terminated)
+		metrics.AdminAction(closeListenerAction, "ok", terminated)
+	})
+	if !found {
+		return fail(w, http.StatusNotFound, "no listener on port")
+	}
+	if grace > 0 {
+		writeJSON(w, http.StatusAccepted, map[string]any{"draining": closed, "grace": grace.String()})
+		return closed, errPending
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"terminated": closed})
+	return closed, nil
+}
@@ -0,0 +1,109 @@
+// Package admin serves a JSON API for inspecting the proxy on a separate port,
+// and for terminating connections and changing log levels when authenticated with the admin token
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/AB-Lindex/tsproxy/internal/admin/api"
+	"github.com/AB-Lindex/tsproxy/internal/proxy"
+)
+
+// Run serves the admin API on addr until ctx is done
+func Run(ctx context.Context, addr string) error {
+	logger := log.FromContext(ctx)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/tsproxies", listTSProxies)
+	mux.HandleFunc("GET /api/v1/tsproxies/{namespace}", listTSProxies)
+	mux.HandleFunc("GET /api/v1/tsproxies/{namespace}/{name}", getTSProxy)
+	mux.HandleFunc("GET /api/v1/ports/{port}", getPort)
+	mux.Handle("DELETE /api/v1/connections/{id}", authorized("close-connection", closeConnection))
+	mux.Handle("DELETE /api/v1/connections", authorized("close-source", closeConnectionsFrom))
+	mux.Handle("DELETE /api/v1/ports/{port}/connections", authorized(closeListenerAction, closeListenerConnections))
+	mux.HandleFunc("GET /api/v1/loglevel", getLogLevel)
+	mux.Handle("PUT /api/v1/loglevel", authorized("set-log-level", setLogLevel))
+	mux.Handle("PUT /api/v1/loglevel/{name}", authorized("set-log-level", setLogLevel))
+	mux.Handle("DELETE /api/v1/loglevel/{name}", authorized("reset-log-level", resetLogLevel))
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+
+	logger.Info("Serving admin API", "address", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// listTSProxies returns all TSProxies, or those of the namespace in the path
+func listTSProxies(w http.ResponseWriter, r *http.Request) {
+	namespace := r.PathValue("namespace")
+
+	var result = []api.TSProxyInfo{}
+	for _, info := range proxy.Snapshot() {
+		if namespace == "" || info.Namespace == namespace {
+			result = append(result, info)
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// getTSProxy returns a single TSProxy
+func getTSProxy(w http.ResponseWriter, r *http.Request) {
+	for _, info := range proxy.Snapshot() {
+		if info.Namespace == r.PathValue("namespace") && info.Name == r.PathValue("name") {
+			writeJSON(w, http.StatusOK, info)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "TSProxy not found")
+}
+
+// getPort returns the service exposing a host port, answering who is connected to it
+func getPort(w http.ResponseWriter, r *http.Request) {
+	port, err := strconv.ParseInt(r.PathValue("port"), 10, 32)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid port")
+		return
+	}
+
+	for _, info := range proxy.Snapshot() {
+		for _, svc := range info.Services {
+			if svc.Key != "" && int32(port) >= svc.ExposeAs && int32(port) < svc.ExposeAs+max(svc.Count, 1) {
+				info.Services = []api.ServiceInfo{svc}
+				writeJSON(w, http.StatusOK, info)
+				return
+			}
+		}
+	}
+	writeError(w, http.StatusNotFound, "no listener on port")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,38 @@
+// Package api holds the JSON types of the admin API, shared by the operator and the kubectl plugin
+package api
+
+import (
+	"time"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+)
+
+// TSProxyInfo describes a TSProxy and its services
+type TSProxyInfo struct {
+	Namespace string        `json:"namespace"`
+	Name      string        `json:"name"`
+	Services  []ServiceInfo `json:"services"`
+}
+
+// ServiceInfo describes a service of a TSProxy and, when it is listening, its live connections
+type ServiceInfo struct {
+	proxyv1alpha1.TSProxyServiceStatus `json:",inline"`
+
+	Key             string           `json:"key,omitempty"`
+	Target          string           `json:"target,omitempty"`
+	Kind            string           `json:"kind,omitempty"`
+	ConnectionCount int              `json:"connectionCount"`
+	Connections     []ConnectionInfo `json:"connections,omitempty"`
+}
+
+// ConnectionInfo describes a live connection
+type ConnectionInfo struct {
+	ID       int       `json:"id"`
+	Workers  [2]int    `json:"workers"`
+	Client   string    `json:"client"`
+	Backend  string    `json:"backend"`
+	Started  time.Time `json:"started"`
+	BytesIn  int64     `json:"bytesIn"`
+	BytesOut int64     `json:"bytesOut"`
+	Idle     float64   `json:"idleSeconds"`
+}
@@ -0,0 +1,49 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/AB-Lindex/tsproxy/internal/loggr"
+)
+
+// logLevels describes the log level and the overrides by logger name
+type logLevels struct {
+	Level   string            `json:"level"`
+	Loggers map[string]string `json:"loggers"`
+}
+
+// getLogLevel returns the log level and the overrides by logger name
+func getLogLevel(w http.ResponseWriter, _ *http.Request) {
+	level, names := loggr.Levels()
+
+	result := logLevels{Level: level.String(), Loggers: make(map[string]string, len(names))}
+	for name, level := range names {
+		result.Loggers[name] = level.String()
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// setLogLevel changes the log level, or of the logger named in the path, to the level query parameter
+func setLogLevel(w http.ResponseWriter, r *http.Request) (int, error) {
+	level, err := loggr.ParseLevel(r.URL.Query().Get("level"))
+	if err != nil {
+		return fail(w, http.StatusBadRequest, err.Error())
+	}
+
+	if name := r.PathValue("name"); name != "" {
+		loggr.SetNameLevel(name, level)
+	} else {
+		loggr.SetLevel(level)
+	}
+	getLogLevel(w, r)
+	return 0, nil
+}
+
+// resetLogLevel removes the override of the logger named in the path
+func resetLogLevel(w http.ResponseWriter, r *http.Request) (int, error) {
+	if !loggr.ResetNameLevel(r.PathValue("name")) {
+		return fail(w, http.StatusNotFound, "no override for logger")
+	}
+	getLogLevel(w, r)
+	return 0, nil
+}
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"context"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+	"github.com/AB-Lindex/tsproxy/internal/proxy"
+)
+
+//+kubebuilder:rbac:groups=proxy.lindex.com,resources=tsproxygrants,verbs=get;list;watch
+
+// targetNamespaceField indexes TSProxies by the other namespaces their services target
+const targetNamespaceField = ".spec.services.namespace"
+
+// targetNamespaces returns the namespaces, other than its own, targeted by the services of obj
+func targetNamespaces(obj client.Object) []string {
+	o := obj.(*proxyv1alpha1.TSProxy)
+
+	var result []string
+	var seen = make(map[string]bool)
+	for _, svc := range o.Spec.Services {
+		if svc.Namespace == "" || svc.Namespace == o.Namespace || seen[svc.Namespace] {
+			continue
+		}
+		seen[svc.Namespace] = true
+		result = append(result, svc.Namespace)
+	}
+	return result
+}
+
+// updateGrants hands the grants of every namespace targeted by o to the proxy
+func (r *TSProxyReconciler) updateGrants(ctx context.Context, o *proxyv1alpha1.TSProxy) error {
+	for _, ns := range targetNamespaces(o) {
+		var list proxyv1alpha1.TSProxyGrantList
+		if err := r.reader(ns).List(ctx, &list, client.InNamespace(ns)); err != nil {
+			return err
+		}
+
+		var grants = make([]proxy.Grant, 0, len(list.Items))
+		for _, item := range list.Items {
+			grant := proxy.Grant{Name: item.Name}
+			for _, from := range item.Spec.From {
+				grant.Namespaces = append(grant.Namespaces, from.Namespace)
+			}
+			for _, to := range item.Spec.To {
+				grant.Services = append(grant.Services, to.Name)
+			}
+			grants = append(grants, grant)
+		}
+		proxy.SetGrants(ns, grants)
+	}
+	return nil
+}
+
+// tsproxiesTargeting maps a changed TSProxyGrant to the TSProxies targeting services in its namespace
+func (r *TSProxyReconciler) tsproxiesTargeting(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.listRequests(ctx, client.MatchingFields{targetNamespaceField: obj.GetNamespace()})
+}
@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+	"github.com/AB-Lindex/tsproxy/internal/options"
+)
+
+//+kubebuilder:rbac:groups="",resources=nodes,verbs=get;list;watch
+
+// taintPrefix is the key prefix of the node taints a TSProxy must tolerate, other taints are ignored
+const taintPrefix = "tsproxy.lindex.com/"
+
+// onNode reports whether o is exposed on the node this instance runs on
+func (r *TSProxyReconciler) onNode(ctx context.Context, o *proxyv1alpha1.TSProxy) (bool, error) {
+	var node corev1.Node
+	if err := r.Get(ctx, client.ObjectKey{Name: options.Flags.NodeName}, &node); err != nil {
+		return false, err
+	}
+
+	if o.Spec.NodeSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(o.Spec.NodeSelector)
+		if err != nil {
+			log.FromContext(ctx).Error(err, "Invalid node selector")
+			return false, nil
+		}
+		if !selector.Matches(labels.Set(node.Labels)) {
+			return false, nil
+		}
+	}
+
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if !strings.HasPrefix(taint.Key, taintPrefix) || taint.Effect == corev1.TaintEffectPreferNoSchedule {
+			continue
+		}
+		if !tolerates(o.Spec.Tolerations, taint) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func tolerates(tolerations []proxyv1alpha1.TSProxyToleration, taint *corev1.Taint) bool {
+	for _, t := range tolerations {
+		toleration := corev1.Toleration{
+			Key:      t.Key,
+			Operator: corev1.TolerationOperator(t.Operator),
+			Value:    t.Value,
+			Effect:   corev1.TaintEffect(t.Effect),
+		}
+		if toleration.ToleratesTaint(taint) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeStatus returns the entry of the node this instance runs on in status, or nil
+func nodeStatus(status *proxyv1alpha1.TSProxyStatus) *proxyv1alpha1.TSProxyNodeStatus {
+	for i := range status.Nodes {
+		if status.Nodes[i].Node == options.Flags.NodeName {
+			return &status.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// updateNodeStatus writes the service states of o on this node to its entry in the status,
+// removing the entry when services is nil.
+// Each node applies only its own entry, so instances on different nodes never conflict.
+// Instances of different proxy classes on a node apply as different field owners,
+// so one removing the entry of a TSProxy moved to the other class leaves the entry of the other.
+func (r *TSProxyReconciler) updateNodeStatus(ctx context.Context, o *proxyv1alpha1.TSProxy, services []proxyv1alpha1.TSProxyServiceStatus) error {
+	current := nodeStatus(&o.Status)
+
+	status := map[string]interface{}{}
+	if services != nil {
+		entry := proxyv1alpha1.TSProxyNodeStatus{
+			Node:               options.Flags.NodeName,
+			ObservedGeneration: o.Generation,
+			Services:           services,
+		}
+		if current != nil && equality.Semantic.DeepEqual(current, &entry) {
+			return nil
+		}
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&entry)
+		if err != nil {
+			return err
+		}
+		status["nodes"] = []interface{}{u}
+	} else if current == nil || !appliedStatus(o) {
+		return nil
+	}
+
+	return r.applyStatus(ctx, o, status, fieldOwner())
+}
+
+// applyStatus applies status to o as owner, and updates o with the result
+func (r *TSProxyReconciler) applyStatus(ctx context.Context, o *proxyv1alpha1.TSProxy, status map[string]interface{}, owner string) error {
+	apply := &unstructured.Unstructured{Object: map[string]interface{}{"status": status}}
+	apply.SetGroupVersionKind(proxyv1alpha1.GroupVersion.WithKind("TSProxy"))
+	apply.SetNamespace(o.Namespace)
+	apply.SetName(o.Name)
+	if err := r.Status().Patch(ctx, apply, client.Apply, client.FieldOwner(owner), client.ForceOwnership); err != nil {
+		return err
+	}
+
+	var updated proxyv1alpha1.TSProxy
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(apply.Object, &updated); err != nil {
+		return err
+	}
+	*o = updated
+	return nil
+}
+
+// summaryOwner is the field manager of the summary, shared by the instances on all nodes
+// as they all derive it from the same node entries
+const summaryOwner = "tsproxy-nodes"
+
+// updateNodeSummary writes the services and the Ready condition summarizing the node entries of o,
+// and resolved as the TargetResolved condition unless nil
+func (r *TSProxyReconciler) updateNodeSummary(ctx context.Context, o *proxyv1alpha1.TSProxy, resolved *metav1.Condition) error {
+	summary := proxyv1alpha1.TSProxyStatus{
+		Conditions: slices.Clone(o.Status.Conditions),
+		Services:   summaryServices(o),
+	}
+
+	ready := readyCondition(o.Generation, summary.Services)
+	if summary.Services == nil {
+		ready.Status = metav1.ConditionFalse
+		ready.Reason = "Pending"
+		ready.Message = "No node has applied the services yet"
+	}
+	meta.SetStatusCondition(&summary.Conditions, ready)
+	if resolved != nil {
+		meta.SetStatusCondition(&summary.Conditions, *resolved)
+	}
+
+	if equality.Semantic.DeepEqual(summary.Conditions, o.Status.Conditions) &&
+		equality.Semantic.DeepEqual(summary.Services, o.Status.Services) {
+		return nil
+	}
+	status, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&summary)
+	if err != nil {
+		return err
+	}
+	return r.applyStatus(ctx, o, status, summaryOwner)
+}
+
+// summaryServices merges the node entries of o. An allocated port already in the summary is kept
+// while any node still exposes it, so the node allocating first decides the port of the others.
+func summaryServices(o *proxyv1alpha1.TSProxy) []proxyv1alpha1.TSProxyServiceStatus {
+	services := o.Status.NodeServices(o.Generation)
+	for i := range services {
+		st := &services[i]
+		for _, prev := range o.Status.Services {
+			if prev.Name == st.Name && prev.ServicePort == st.ServicePort && prev.Count == st.Count &&
+				prev.ExposeAs != 0 && exposedOnNode(o, i, prev.ExposeAs) {
+				st.ExposeAs = prev.ExposeAs
+			}
+		}
+	}
+	return services
+}
+
+// exposedOnNode reports whether service i of o is exposed as port on any node
+func exposedOnNode(o *proxyv1alpha1.TSProxy, i int, port int32) bool {
+	for _, n := range o.Status.Nodes {
+		if n.ObservedGeneration == o.Generation && i < len(n.Services) && n.Services[i].ExposeAs == port {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldOwner is the field manager of the node entries applied by this instance
+func fieldOwner() string {
+	owner := "tsproxy-" + options.Flags.NodeName
+	if options.Flags.ProxyClass != "" {
+		owner += "-" + options.Flags.ProxyClass
+	}
+	return owner
+}
+
+// appliedStatus reports whether this instance applied to the status of o, so it has an entry to remove
+func appliedStatus(o *proxyv1alpha1.TSProxy) bool {
+	for _, m := range o.ManagedFields {
+		if m.Manager == fieldOwner() && m.Subresource == "status" {
+			return true
+		}
+	}
+	return false
+}
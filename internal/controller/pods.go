@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+	"github.com/AB-Lindex/tsproxy/internal/proxy"
+)
+
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+
+// podNamespaceField indexes TSProxies by the namespaces of the pods their services select
+const podNamespaceField = ".spec.services.selector"
+
+// podNamespaces returns the namespaces of the pods selected by the services of obj
+func podNamespaces(obj client.Object) []string {
+	o := obj.(*proxyv1alpha1.TSProxy)
+
+	var result []string
+	var seen = make(map[string]bool)
+	for i := range o.Spec.Services {
+		svc := &o.Spec.Services[i]
+		if svc.Selector == nil {
+			continue
+		}
+		ns := svc.Namespace
+		if ns == "" {
+			ns = o.Namespace
+		}
+		if !seen[ns] {
+			seen[ns] = true
+			result = append(result, ns)
+		}
+	}
+	return result
+}
+
+// updateBackends hands the ready pods selected by each service of o with a selector to the proxy
+func (r *TSProxyReconciler) updateBackends(ctx context.Context, o *proxyv1alpha1.TSProxy) error {
+	logger := log.FromContext(ctx)
+
+	key := client.ObjectKeyFromObject(o)
+	for i := range o.Spec.Services {
+		svc := &o.Spec.Services[i]
+		if svc.Selector == nil {
+			continue
+		}
+		ns := svc.Namespace
+		if ns == "" {
+			ns = o.Namespace
+		}
+
+		selector, err := metav1.LabelSelectorAsSelector(svc.Selector)
+		if err != nil {
+			logger.Error(err, "Invalid pod selector", "service", svc.Name)
+			proxy.SetBackends(key, svc, nil)
+			continue
+		}
+
+		var pods corev1.PodList
+		if err := r.reader(ns).List(ctx, &pods, client.InNamespace(ns), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			return err
+		}
+
+		var backends []proxy.Backend
+		for i := range pods.Items {
+			pod := &pods.Items[i]
+			if !isPodReady(pod) {
+				continue
+			}
+			port := svc.ServicePort
+			if svc.PortName != "" {
+				if port = containerPort(pod, svc.PortName); port == 0 {
+					continue
+				}
+			}
+			backends = append(backends, proxy.Backend{IP: pod.Status.PodIP, Port: port})
+		}
+		proxy.SetBackends(key, svc, backends)
+	}
+	return nil
+}
+
+// isPodReady reports whether pod has an IP, is not terminating and has the Ready condition
+func isPodReady(pod *corev1.Pod) bool {
+	if pod.Status.PodIP == "" || pod.DeletionTimestamp != nil {
+		return false
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// containerPort returns the number of the named container port of pod, or 0 if it has none
+func containerPort(pod *corev1.Pod, name string) int32 {
+	for _, c := range pod.Spec.Containers {
+		for _, p := range c.Ports {
+			if p.Name == name {
+				return p.ContainerPort
+			}
+		}
+	}
+	return 0
+}
+
+// tsproxiesSelecting maps a changed Pod to the TSProxies selecting pods in its namespace
+func (r *TSProxyReconciler) tsproxiesSelecting(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.listRequests(ctx, client.MatchingFields{podNamespaceField: obj.GetNamespace()})
+}
@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"context"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+	"github.com/AB-Lindex/tsproxy/internal/options"
+	"github.com/AB-Lindex/tsproxy/internal/proxy"
+)
+
+//+kubebuilder:rbac:groups=proxy.lindex.com,resources=tsproxypolicies,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+
+// namespacePolicy returns the policy of the TSProxyPolicy with the lowest name selecting namespace ns,
+// or nil if no TSProxyPolicy selects it
+func (r *TSProxyReconciler) namespacePolicy(ctx context.Context, ns string) (*proxy.NamespacePolicy, error) {
+	logger := log.FromContext(ctx)
+
+	var namespace corev1.Namespace
+	if err := r.Get(ctx, client.ObjectKey{Name: ns}, &namespace); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+
+	var policies proxyv1alpha1.TSProxyPolicyList
+	if err := r.List(ctx, &policies); err != nil {
+		return nil, err
+	}
+	sort.Slice(policies.Items, func(i, j int) bool {
+		return policies.Items[i].Name < policies.Items[j].Name
+	})
+
+	for i := range policies.Items {
+		policy := &policies.Items[i]
+		selector, err := metav1.LabelSelectorAsSelector(&policy.Spec.NamespaceSelector)
+		if err != nil {
+			logger.Error(err, "Invalid namespace selector in TSProxyPolicy", "policy", policy.Name)
+			continue
+		}
+		if selector.Matches(labels.Set(namespace.Labels)) {
+			return toNamespacePolicy(ctx, policy), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func toNamespacePolicy(ctx context.Context, policy *proxyv1alpha1.TSProxyPolicy) *proxy.NamespacePolicy {
+	logger := log.FromContext(ctx)
+
+	p := &proxy.NamespacePolicy{
+		Name:        policy.Name,
+		MaxPorts:    -1,
+		MaxServices: -1,
+	}
+	for _, pr := range policy.Spec.AllowedPorts {
+		if err := p.AllowedPorts.Set(string(pr)); err != nil {
+			logger.Error(err, "Invalid allowed ports in TSProxyPolicy", "policy", policy.Name)
+		}
+	}
+	if policy.Spec.MaxPorts != nil {
+		p.MaxPorts = *policy.Spec.MaxPorts
+	}
+	if policy.Spec.MaxServices != nil {
+		p.MaxServices = *policy.Spec.MaxServices
+	}
+	return p
+}
+
+// updateNamespacePolicy hands the policy of namespace ns, and the TSProxies counting against it,
+// to the proxy when policies are enforced
+func (r *TSProxyReconciler) updateNamespacePolicy(ctx context.Context, ns string) error {
+	if !options.Flags.EnforcePolicies {
+		return nil
+	}
+
+	policy, err := r.namespacePolicy(ctx, ns)
+	if err != nil {
+		return err
+	}
+	proxy.SetNamespacePolicy(ns, policy)
+
+	var list proxyv1alpha1.TSProxyList
+	if err := r.List(ctx, &list, client.InNamespace(ns)); err != nil {
+		return err
+	}
+	var peers = make([]*proxyv1alpha1.TSProxy, 0, len(list.Items))
+	for i := range list.Items {
+		peers = append(peers, &list.Items[i])
+	}
+	proxy.SetNamespaceProxies(ns, peers)
+	return nil
+}
+
+// allTSProxies maps a changed TSProxyPolicy to every TSProxy
+func (r *TSProxyReconciler) allTSProxies(ctx context.Context, _ client.Object) []reconcile.Request {
+	return r.listRequests(ctx)
+}
+
+// tsproxiesInNamespace maps a changed Namespace to the TSProxies in it
+func (r *TSProxyReconciler) tsproxiesInNamespace(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.listRequests(ctx, client.InNamespace(obj.GetName()))
+}
+
+// tsproxiesBeside maps a changed TSProxy to the TSProxies in its namespace
+func (r *TSProxyReconciler) tsproxiesBeside(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.listRequests(ctx, client.InNamespace(obj.GetNamespace()))
+}
+
+func (r *TSProxyReconciler) listRequests(ctx context.Context, opts ...client.ListOption) []reconcile.Request {
+	var list proxyv1alpha1.TSProxyList
+	if err := r.List(ctx, &list, opts...); err != nil {
+		log.FromContext(ctx).Error(err, "Unable to list TSProxies")
+		return nil
+	}
+
+	var requests = make([]reconcile.Request, 0, len(list.Items))
+	for i := range list.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&list.Items[i])})
+	}
+	return requests
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+	"github.com/AB-Lindex/tsproxy/internal/options"
+)
+
+// WatchedNamespaces returns the namespaces the cache is limited to, empty for all.
+// The namespaces matching --watch-namespace-selector are resolved once with c, narrowing --watch-namespaces
+// if given too, so namespaces labelled later are only watched after a restart.
+func WatchedNamespaces(ctx context.Context, c client.Reader) ([]string, error) {
+	if options.Flags.WatchNamespaceSelector == "" {
+		return options.Flags.WatchNamespaces, nil
+	}
+	selector, err := labels.Parse(options.Flags.WatchNamespaceSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	var list corev1.NamespaceList
+	if err := c.List(ctx, &list, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, ns := range list.Items {
+		if len(options.Flags.WatchNamespaces) == 0 || slices.Contains(options.Flags.WatchNamespaces, ns.Name) {
+			result = append(result, ns.Name)
+		}
+	}
+	if len(result) == 0 {
+		// an empty list would watch all namespaces
+		return nil, fmt.Errorf("no namespace matches the selector %q", options.Flags.WatchNamespaceSelector)
+	}
+	return result, nil
+}
+
+// inScope reports whether the TSProxies of namespace ns are handled by this controller.
+// The cache only holds the namespaces selected at startup, this drops those whose labels no longer match.
+func (r *TSProxyReconciler) inScope(ctx context.Context, ns string) (bool, error) {
+	if r.namespaceSelector == nil {
+		return true, nil
+	}
+
+	var namespace corev1.Namespace
+	if err := r.Get(ctx, client.ObjectKey{Name: ns}, &namespace); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return r.namespaceSelector.Matches(labels.Set(namespace.Labels)), nil
+}
+
+// watched reports whether namespace ns is in the cache
+func watched(ns string) bool {
+	return len(options.Flags.WatchNamespaces) == 0 || slices.Contains(options.Flags.WatchNamespaces, ns)
+}
+
+// reader returns the reader for objects in namespace ns. Namespaces outside the cache are read
+// from the API server, so TSProxies may target them when the cache is limited with --watch-namespaces.
+func (r *TSProxyReconciler) reader(ns string) client.Reader {
+	if watched(ns) || r.APIReader == nil {
+		return r.Client
+	}
+	return r.APIReader
+}
+
+// targetsUnwatched reports whether o targets a namespace outside the cache,
+// whose changes are only seen when o is reconciled again
+func targetsUnwatched(o *proxyv1alpha1.TSProxy) bool {
+	for _, ns := range targetNamespaces(o) {
+		if !watched(ns) {
+			return true
+		}
+	}
+	return false
+}
+
+// namespaceChanged maps a changed Namespace to the TSProxies in it,
+// and tells when a namespace not in the cache now matches the selector
+func (r *TSProxyReconciler) namespaceChanged(ctx context.Context, obj client.Object) []reconcile.Request {
+	if r.namespaceSelector != nil && r.namespaceSelector.Matches(labels.Set(obj.GetLabels())) &&
+		!watched(obj.GetName()) {
+		log.FromContext(ctx).Info("Namespace matches the selector but is not watched - restart to handle its TSProxies",
+			"namespace", obj.GetName())
+	}
+	return r.tsproxiesInNamespace(ctx, obj)
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+	"github.com/AB-Lindex/tsproxy/internal/proxy"
+)
+
+//+kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch
+
+// serviceField indexes TSProxies by the namespace/name of the Services they target
+const serviceField = ".spec.services.service"
+
+// serviceKeys returns the keys of the Services targeted by obj, leaving out hosts and pod selectors
+func serviceKeys(obj client.Object) []string {
+	o := obj.(*proxyv1alpha1.TSProxy)
+
+	var result []string
+	for _, svc := range o.Spec.Services {
+		if svc.Host != "" || svc.Selector != nil {
+			continue
+		}
+		result = append(result, serviceKey(o, &svc).String())
+	}
+	return result
+}
+
+// serviceKey returns the key of the Service targeted by svc of o
+func serviceKey(o *proxyv1alpha1.TSProxy, svc *proxyv1alpha1.TSProxyService) types.NamespacedName {
+	key := types.NamespacedName{Namespace: svc.Namespace, Name: svc.Name}
+	if key.Namespace == "" {
+		key.Namespace = o.Namespace
+	}
+	return key
+}
+
+// updateServices tells the proxy about the Services targeted by o, so ExternalName Services
+// are checked against the allowed external destinations and port names are resolved
+func (r *TSProxyReconciler) updateServices(ctx context.Context, o *proxyv1alpha1.TSProxy) error {
+	for _, svc := range o.Spec.Services {
+		if svc.Host != "" || svc.Selector != nil {
+			continue
+		}
+
+		key := serviceKey(o, &svc)
+
+		var service corev1.Service
+		if err := r.reader(key.Namespace).Get(ctx, key, &service); err != nil {
+			if client.IgnoreNotFound(err) != nil {
+				return err
+			}
+			proxy.SetService(key, nil)
+			continue
+		}
+
+		s := &proxy.Service{Ports: make(map[string]int32)}
+		if service.Spec.Type == corev1.ServiceTypeExternalName {
+			s.ExternalName = service.Spec.ExternalName
+		}
+		for _, port := range service.Spec.Ports {
+			s.Ports[port.Name] = port.Port
+		}
+		proxy.SetService(key, s)
+	}
+	return nil
+}
+
+// tsproxiesUsing maps a changed Service to the TSProxies targeting it
+func (r *TSProxyReconciler) tsproxiesUsing(ctx context.Context, obj client.Object) []reconcile.Request {
+	return r.listRequests(ctx, client.MatchingFields{serviceField: client.ObjectKeyFromObject(obj).String()})
+}
@@ -18,20 +18,44 @@ package controller
 
 import (
 	"context"
+	"errors"
+	"strings"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+	"github.com/AB-Lindex/tsproxy/internal/options"
 	"github.com/AB-Lindex/tsproxy/internal/proxy"
 )
 
+// retryInterval is how often a TSProxy with inactive services is retried
+const retryInterval = 30 * time.Second
+
 // TSProxyReconciler reconciles a TSProxy object
 type TSProxyReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// APIReader reads targets in namespaces outside the cache, see --watch-namespaces
+	APIReader client.Reader
+
+	restored          bool
+	namespaceSelector labels.Selector
 }
 
 //+kubebuilder:rbac:groups=proxy.lindex.com,resources=tsproxies,verbs=get;list;watch;create;update;patch;delete
@@ -50,20 +74,257 @@ type TSProxyReconciler struct {
 func (r *TSProxyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	_ = log.FromContext(ctx)
 
-	var o = &proxyv1alpha1.TSProxy{}
-	err := r.Get(ctx, req.NamespacedName, o, &client.GetOptions{}) // client.CacheOptions{Reader: nocache})
+	if err := r.restoreAllocations(ctx); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.updateNamespacePolicy(ctx, req.Namespace); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	inScope, err := r.inScope(ctx, req.Namespace)
 	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	var o = &proxyv1alpha1.TSProxy{}
+	err = r.Get(ctx, req.NamespacedName, o, &client.GetOptions{}) // client.CacheOptions{Reader: nocache})
+	if err != nil || !inScope {
+		o = nil
+	}
+	// a TSProxy moved to another class, or not selecting this node, has its ports closed here,
+	// and when running per node its entry removed from the status
+	var offNode *proxyv1alpha1.TSProxy
+	if o != nil && !options.HandlesClass(o.Spec.ProxyClassName) {
+		if options.Flags.NodeName != "" {
+			offNode = o
+		}
 		o = nil
 	}
+	if o != nil && options.Flags.NodeName != "" {
+		selected, err := r.onNode(ctx, o)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !selected {
+			offNode, o = o, nil
+		}
+	}
 
-	proxy.Reload(ctx, req.NamespacedName, o)
+	if o != nil {
+		if err := r.updateGrants(ctx, o); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := r.updateServices(ctx, o); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := r.updateBackends(ctx, o); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	services := proxy.Reload(ctx, req.NamespacedName, o)
+	if offNode != nil {
+		if err := r.updateNodeStatus(ctx, offNode, nil); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, r.updateNodeSummary(ctx, offNode, nil)
+	}
+	if o == nil {
+		return ctrl.Result{}, nil
+	}
+
+	if err := r.updateStatus(ctx, o, services); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	for _, svc := range services {
+		if svc.State != proxyv1alpha1.ServiceActive {
+			return ctrl.Result{RequeueAfter: retryInterval}, nil
+		}
+	}
+	if targetsUnwatched(o) {
+		// changes outside the cache trigger no reconcile
+		return ctrl.Result{RequeueAfter: retryInterval}, nil
+	}
 
 	return ctrl.Result{}, nil
 }
 
+// restoreAllocations registers the ports allocated in an earlier run, once, before the first reload
+func (r *TSProxyReconciler) restoreAllocations(ctx context.Context) error {
+	if r.restored {
+		return nil
+	}
+
+	var list proxyv1alpha1.TSProxyList
+	if err := r.List(ctx, &list); err != nil {
+		return err
+	}
+	for i := range list.Items {
+		if !options.HandlesClass(list.Items[i].Spec.ProxyClassName) {
+			continue
+		}
+		if inScope, err := r.inScope(ctx, list.Items[i].Namespace); err != nil || !inScope {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		status := list.Items[i].Status
+		if options.Flags.NodeName != "" {
+			// the ports of this node are in its own entry
+			status = proxyv1alpha1.TSProxyStatus{}
+			if node := nodeStatus(&list.Items[i].Status); node != nil {
+				status.Services = node.Services
+			}
+		}
+		proxy.Restore(client.ObjectKeyFromObject(&list.Items[i]), status)
+	}
+
+	r.restored = true
+	return nil
+}
+
+// updateStatus writes the service states to the TSProxy status if they changed.
+// When running per node the entry of this node is written, and the summary of all nodes.
+func (r *TSProxyReconciler) updateStatus(ctx context.Context, o *proxyv1alpha1.TSProxy, services []proxyv1alpha1.TSProxyServiceStatus) error {
+	if options.Flags.NodeName != "" {
+		if services == nil {
+			services = []proxyv1alpha1.TSProxyServiceStatus{}
+		}
+		if err := r.updateNodeStatus(ctx, o, services); err != nil {
+			return err
+		}
+		resolved := targetResolvedCondition(o)
+		return r.updateNodeSummary(ctx, o, &resolved)
+	}
+
+	status := o.Status.DeepCopy()
+	status.ObservedGeneration = o.Generation
+	status.Services = services
+	meta.SetStatusCondition(&status.Conditions, readyCondition(o.Generation, services))
+	meta.SetStatusCondition(&status.Conditions, targetResolvedCondition(o))
+
+	if equality.Semantic.DeepEqual(&o.Status, status) {
+		return nil
+	}
+
+	o.Status = *status
+	return r.Status().Update(ctx, o)
+}
+
+// readyCondition summarizes the service states into the Ready condition
+func readyCondition(generation int64, services []proxyv1alpha1.TSProxyServiceStatus) metav1.Condition {
+	cond := metav1.Condition{
+		Type:               proxyv1alpha1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: generation,
+		Reason:             "Active",
+		Message:            "All services are active",
+	}
+
+	var messages []string
+	for _, svc := range services {
+		if svc.State == proxyv1alpha1.ServiceActive {
+			continue
+		}
+		if cond.Status == metav1.ConditionTrue {
+			cond.Status = metav1.ConditionFalse
+			cond.Reason = string(svc.State)
+		}
+		messages = append(messages, svc.Name+": "+svc.Message)
+	}
+	if len(messages) > 0 {
+		cond.Message = strings.Join(messages, "; ")
+	}
+
+	return cond
+}
+
+// targetResolvedCondition reports whether the Service and ports, or ready pods, of every service exist
+func targetResolvedCondition(o *proxyv1alpha1.TSProxy) metav1.Condition {
+	cond := metav1.Condition{
+		Type:               proxyv1alpha1.ConditionTargetResolved,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: o.Generation,
+		Reason:             "Resolved",
+		Message:            "All targets exist",
+	}
+
+	var messages []string
+	key := client.ObjectKeyFromObject(o)
+	for i := range o.Spec.Services {
+		var unresolved *proxy.TargetError
+		if !errors.As(proxy.ResolveTarget(key, &o.Spec.Services[i]), &unresolved) {
+			continue
+		}
+		if cond.Status == metav1.ConditionTrue {
+			cond.Status = metav1.ConditionFalse
+			cond.Reason = unresolved.Reason
+		}
+		messages = append(messages, o.Spec.Services[i].Name+": "+unresolved.Message)
+	}
+	if len(messages) > 0 {
+		cond.Message = strings.Join(messages, "; ")
+	}
+
+	return cond
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *TSProxyReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	if options.Flags.WatchNamespaceSelector != "" {
+		selector, err := labels.Parse(options.Flags.WatchNamespaceSelector)
+		if err != nil {
+			return err
+		}
+		r.namespaceSelector = selector
+	}
+
+	// TSProxies targeting other namespaces are found by index when a TSProxyGrant changes
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &proxyv1alpha1.TSProxy{},
+		targetNamespaceField, targetNamespaces); err != nil {
+		return err
+	}
+	// and TSProxies selecting pods when a Pod changes
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &proxyv1alpha1.TSProxy{},
+		podNamespaceField, podNamespaces); err != nil {
+		return err
+	}
+	// and TSProxies targeting a Service when it changes
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &proxyv1alpha1.TSProxy{},
+		serviceField, serviceKeys); err != nil {
+		return err
+	}
+
+	// TSProxies that lose or may regain a port to another TSProxy are reconciled again
+	changed := make(chan event.GenericEvent)
+	proxy.OnChange(func(key types.NamespacedName) {
+		obj := &proxyv1alpha1.TSProxy{}
+		obj.Namespace, obj.Name = key.Namespace, key.Name
+		go func() { changed <- event.GenericEvent{Object: obj} }()
+	})
+
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&proxyv1alpha1.TSProxy{}).
-		Complete(r)
+		WatchesRawSource(source.Channel(changed, &handler.EnqueueRequestForObject{})).
+		Watches(&proxyv1alpha1.TSProxyGrant{}, handler.EnqueueRequestsFromMapFunc(r.tsproxiesTargeting)).
+		Watches(&corev1.Pod{}, handler.EnqueueRequestsFromMapFunc(r.tsproxiesSelecting)).
+		Watches(&corev1.Service{}, handler.EnqueueRequestsFromMapFunc(r.tsproxiesUsing))
+
+	if options.Flags.EnforcePolicies {
+		b = b.Watches(&proxyv1alpha1.TSProxyPolicy{}, handler.EnqueueRequestsFromMapFunc(r.allTSProxies))
+		// the younger TSProxies of a namespace may exceed its limits when the services of another change
+		b = b.Watches(&proxyv1alpha1.TSProxy{}, handler.EnqueueRequestsFromMapFunc(r.tsproxiesBeside),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}))
+	}
+	if options.Flags.NodeName != "" {
+		// only our own node is in the cache, a change of its labels or taints may select or drop any TSProxy
+		b = b.Watches(&corev1.Node{}, handler.EnqueueRequestsFromMapFunc(r.allTSProxies))
+	}
+	if options.Flags.EnforcePolicies || r.namespaceSelector != nil {
+		b = b.Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(r.namespaceChanged))
+	}
+
+	return b.Complete(r)
 }
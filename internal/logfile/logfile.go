@@ -0,0 +1,109 @@
+// Package logfile writes log files rotated by size, shared by the operator log and the access log
+package logfile
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// File appends to path and, when it would grow beyond maxSize bytes,
+// renames it to path.1, shifting older files up to path.<maxBackups> and removing the oldest.
+// Without backups it is truncated instead. Rotated files older than maxAge are removed too.
+// Writes are safe for concurrent use.
+type File struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	maxAge     time.Duration
+
+	mutex sync.Mutex
+	file  *os.File
+	size  int64
+}
+
+// Open opens path for appending. Zero maxSize never rotates, zero maxAge keeps rotated files of any age.
+func Open(path string, maxSize int64, maxBackups int, maxAge time.Duration) (*File, error) {
+	f := &File{path: path, maxSize: maxSize, maxBackups: maxBackups, maxAge: maxAge}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *File) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			// p still goes to the current file, and the next write tries to rotate again
+			n, werr := f.file.Write(p)
+			f.size += int64(n)
+			return n, cmp.Or(werr, err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate moves the current file to the first backup and opens a new one.
+// The current file stays open until then, so it is kept, under its own name, when rotating fails.
+func (f *File) rotate() error {
+	if f.maxBackups < 1 {
+		if err := f.file.Truncate(0); err != nil {
+			return err
+		}
+		f.size = 0
+		return nil
+	}
+
+	_ = os.Remove(f.backup(f.maxBackups))
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		_ = os.Rename(f.backup(i), f.backup(i+1))
+	}
+	if err := os.Rename(f.path, f.backup(1)); err != nil {
+		return err
+	}
+	current := f.file
+	if err := f.open(); err != nil {
+		_ = os.Rename(f.backup(1), f.path)
+		return err
+	}
+	_ = current.Close()
+	f.removeExpired()
+	return nil
+}
+
+// removeExpired removes the rotated files last written more than maxAge ago
+func (f *File) removeExpired() {
+	if f.maxAge <= 0 {
+		return
+	}
+	for i := 1; i <= f.maxBackups; i++ {
+		if info, err := os.Stat(f.backup(i)); err == nil && time.Since(info.ModTime()) > f.maxAge {
+			_ = os.Remove(f.backup(i))
+		}
+	}
+}
+
+func (f *File) backup(i int) string {
+	return fmt.Sprintf("%s.%d", f.path, i)
+}
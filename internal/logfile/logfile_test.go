@@ -0,0 +1,74 @@
+package logfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tsproxy.log")
+	f, err := Open(path, 10, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, want := range map[string]string{path: "third\n", path + ".1": "second\n", path + ".2": "first\n"} {
+		if data, _ := os.ReadFile(name); string(data) != want {
+			t.Errorf("%s = %q, want %q", name, data, want)
+		}
+	}
+}
+
+func TestRotateFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tsproxy.log")
+	f, err := Open(path, 10, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// a directory in the way of the backup makes the rename fail
+	if err := os.MkdirAll(filepath.Join(path+".1", "blocked"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := f.Write([]byte("second\n")); err == nil || n != len("second\n") {
+		t.Errorf("Write = %d, %v, want all written and the rotation error", n, err)
+	}
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("third\n")); err != nil {
+		t.Fatalf("Write after the failure: %v", err)
+	}
+
+	for name, want := range map[string]string{path: "third\n", path + ".1": "first\nsecond\n"} {
+		if data, _ := os.ReadFile(name); string(data) != want {
+			t.Errorf("%s = %q, want %q", name, data, want)
+		}
+	}
+}
+
+func TestTruncateWithoutBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tsproxy.log")
+	f, err := Open(path, 10, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, _ := os.ReadFile(path); string(data) != "second\n" {
+		t.Errorf("%s = %q, want %q", path, data, "second\n")
+	}
+}
@@ -0,0 +1,113 @@
+package loggr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+)
+
+// levels holds the lowest level logged, overridden for loggers by name
+type levels struct {
+	level zerolog.Level
+	names map[string]zerolog.Level
+}
+
+var (
+	current     atomic.Pointer[levels]
+	levelsMutex sync.Mutex
+)
+
+func init() {
+	current.Store(&levels{level: zerolog.InfoLevel})
+	// the levels are filtered by the sink, zerolog's own global level would drop trace
+	zerolog.SetGlobalLevel(zerolog.TraceLevel)
+}
+
+// vLevel maps a logr verbosity onto a zerolog level: V(0) is info, V(1) debug and higher trace
+func vLevel(v int) zerolog.Level {
+	switch {
+	case v <= 0:
+		return zerolog.InfoLevel
+	case v == 1:
+		return zerolog.DebugLevel
+	default:
+		return zerolog.TraceLevel
+	}
+}
+
+// threshold returns the lowest level logged by the logger name.
+// An override of "controller-runtime" also applies to "controller-runtime.cache".
+func threshold(name string) zerolog.Level {
+	lv := current.Load()
+	for len(lv.names) > 0 && name != "" {
+		if level, found := lv.names[name]; found {
+			return level
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+	return lv.level
+}
+
+// update replaces the levels with a changed copy
+func update(change func(*levels)) {
+	levelsMutex.Lock()
+	defer levelsMutex.Unlock()
+
+	old := current.Load()
+	lv := &levels{level: old.level, names: make(map[string]zerolog.Level, len(old.names))}
+	for name, level := range old.names {
+		lv.names[name] = level
+	}
+	change(lv)
+	current.Store(lv)
+}
+
+// SetLevel sets the lowest level logged by loggers without an override
+func SetLevel(level zerolog.Level) {
+	update(func(lv *levels) { lv.level = level })
+}
+
+// SetNameLevel overrides the level of the logger name and the loggers named below it
+func SetNameLevel(name string, level zerolog.Level) {
+	update(func(lv *levels) { lv.names[name] = level })
+}
+
+// ResetNameLevel removes the override of the logger name, reporting whether there was one
+func ResetNameLevel(name string) bool {
+	var found bool
+	update(func(lv *levels) {
+		_, found = lv.names[name]
+		delete(lv.names, name)
+	})
+	return found
+}
+
+// Levels returns the level and the overrides by logger name
+func Levels() (zerolog.Level, map[string]zerolog.Level) {
+	lv := current.Load()
+	names := make(map[string]zerolog.Level, len(lv.names))
+	for name, level := range lv.names {
+		names[name] = level
+	}
+	return lv.level, names
+}
+
+// ParseLevel parses a level name (trace, debug, info, warn, error or disabled), or a logr verbosity like --zap-log-level
+func ParseLevel(s string) (zerolog.Level, error) {
+	if v, err := strconv.Atoi(s); err == nil && v >= 0 {
+		return vLevel(v), nil
+	}
+	level, err := zerolog.ParseLevel(strings.ToLower(s))
+	if err != nil || level == zerolog.NoLevel {
+		return zerolog.NoLevel, fmt.Errorf("invalid log level %q", s)
+	}
+	return level, nil
+}
@@ -0,0 +1,238 @@
+package loggr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"github.com/AB-Lindex/tsproxy/internal/logfile"
+	"github.com/AB-Lindex/tsproxy/internal/options"
+)
+
+// consoleTimeFormat is how the console format shows timestamps unless --log-time-format is a layout
+const consoleTimeFormat = "15:04:05.999"
+
+// timeFormats are the names accepted by --log-time-format, other values are time layouts
+var timeFormats = map[string]string{
+	"rfc3339nano": time.RFC3339Nano,
+	"rfc3339":     time.RFC3339,
+	"unix":        zerolog.TimeFormatUnix,
+	"unixms":      zerolog.TimeFormatUnixMs,
+	"unixmicro":   zerolog.TimeFormatUnixMicro,
+	"unixnano":    zerolog.TimeFormatUnixNano,
+}
+
+// Configure sets the format, destination, timestamp format and field names of the log from options.Flags.
+// It runs with the defaults at startup, and must run again after the flags are parsed, before New.
+func Configure() error {
+	if err := setFieldNames(options.Flags.LogFieldNames); err != nil {
+		return err
+	}
+
+	out, err := openOutput(options.Flags.LogOutput)
+	if err != nil {
+		return err
+	}
+
+	format := options.Flags.LogFormat
+	if format == "" || format == "auto" {
+		format = "json"
+		if isTerminal(out) {
+			format = "console"
+		}
+	}
+
+	timeFormat := time.RFC3339Nano
+	if format == "console" {
+		timeFormat = zerolog.TimeFormatUnixMs
+	}
+	if name := options.Flags.LogTimeFormat; name != "" {
+		var found bool
+		if timeFormat, found = timeFormats[strings.ToLower(name)]; !found {
+			timeFormat = name
+		}
+	}
+	zerolog.TimeFieldFormat = timeFormat
+	// the console shows the timestamp in the format given, unless it is a number
+	layout := options.Flags.LogTimeFormat != "" && timeFormat != zerolog.TimeFormatUnix && !strings.HasPrefix(timeFormat, "UNIX")
+
+	var w io.Writer
+	switch format {
+	case "json":
+		w = out
+	case "console":
+		shown := consoleTimeFormat
+		if layout {
+			shown = timeFormat
+		}
+		color := isTerminal(out)
+		w = formatWriter{out: out, format: func(p []byte) ([]byte, error) {
+			var buf bytes.Buffer
+			_, err := zerolog.ConsoleWriter{Out: &buf, TimeFormat: shown, NoColor: !color}.Write(p)
+			return buf.Bytes(), err
+		}}
+	case "logfmt":
+		w = formatWriter{out: out, format: logfmt}
+	default:
+		return fmt.Errorf("unknown log format %q, expected json, console or logfmt", format)
+	}
+
+	log.Logger = zerolog.New(w).With().Timestamp().Logger()
+	return nil
+}
+
+// openOutput opens the destination of the log: stdout, stderr, syslog, syslog:<socket> or a file
+func openOutput(output string) (io.Writer, error) {
+	switch {
+	case output == "" || output == "stdout":
+		return os.Stdout, nil
+	case output == "stderr":
+		return os.Stderr, nil
+	case output == "syslog":
+		return openSyslog("")
+	case strings.HasPrefix(output, "syslog:"):
+		return openSyslog(strings.TrimPrefix(output, "syslog:"))
+	default:
+		return logfile.Open(output, int64(options.Flags.LogMaxSize)<<20, options.Flags.LogMaxBackups, options.Flags.LogMaxAge)
+	}
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// setFieldNames sets the names of the standard fields from a list like timestamp=time,message=msg
+func setFieldNames(list string) error {
+	zerolog.TimestampFieldName = "ts"
+	zerolog.LevelFieldName = "level"
+	zerolog.MessageFieldName = "message"
+	zerolog.ErrorFieldName = "error"
+	zerolog.CallerFieldName = "caller"
+	nameField = "logger"
+
+	for _, pair := range strings.Split(list, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		field, name, found := strings.Cut(pair, "=")
+		if !found || name == "" {
+			return fmt.Errorf("invalid log field name %q, expected field=name", pair)
+		}
+		switch field {
+		case "timestamp":
+			zerolog.TimestampFieldName = name
+		case "level":
+			zerolog.LevelFieldName = name
+		case "message":
+			zerolog.MessageFieldName = name
+		case "error":
+			zerolog.ErrorFieldName = name
+		case "caller":
+			zerolog.CallerFieldName = name
+		case "logger":
+			nameField = name
+		default:
+			return fmt.Errorf("unknown log field %q, expected timestamp, level, message, error, caller or logger", field)
+		}
+	}
+	return nil
+}
+
+// formatWriter reformats each JSON line from zerolog before writing it to out.
+// Levels are passed on when out is a zerolog.LevelWriter, like syslog.
+type formatWriter struct {
+	out    io.Writer
+	format func(p []byte) ([]byte, error)
+}
+
+func (f formatWriter) Write(p []byte) (int, error) {
+	return f.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (f formatWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	line, err := f.format(p)
+	if err != nil {
+		return 0, err
+	}
+	if lw, ok := f.out.(zerolog.LevelWriter); ok {
+		_, err = lw.WriteLevel(level, line)
+	} else {
+		_, err = f.out.Write(line)
+	}
+	return len(p), err
+}
+
+// logfmt converts a JSON line to key=value pairs, the standard fields first and the others sorted
+func logfmt(p []byte) ([]byte, error) {
+	var fields map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(p))
+	d.UseNumber()
+	if err := d.Decode(&fields); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	write := func(key string) {
+		value, found := fields[key]
+		if !found {
+			return
+		}
+		delete(fields, key)
+		if buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(key)
+		buf.WriteByte('=')
+		buf.WriteString(logfmtValue(value))
+	}
+
+	for _, key := range []string{zerolog.TimestampFieldName, zerolog.LevelFieldName, nameField,
+		zerolog.CallerFieldName, zerolog.MessageFieldName} {
+		write(key)
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		write(key)
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func logfmtValue(value interface{}) string {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return "null"
+	default:
+		b, _ := json.Marshal(v)
+		s = string(b)
+	}
+	if s == "" || strings.ContainsAny(s, " =\"\\\t\r\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
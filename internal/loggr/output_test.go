@@ -0,0 +1,42 @@
+package loggr
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestLogfmt(t *testing.T) {
+	line := `{"level":"info","zeta":1,"alpha":"two words","logger":"setup","ts":"2024-05-01T10:00:00Z",` +
+		`"message":"Starting","nested":{"a":true},"empty":"","ok":false}` + "\n"
+
+	result, err := logfmt([]byte(line))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `ts=2024-05-01T10:00:00Z level=info logger=setup message=Starting alpha="two words" empty="" ` +
+		`nested="{\"a\":true}" ok=false zeta=1` + "\n"
+	if string(result) != expected {
+		t.Errorf("logfmt =\n%s\nexpected\n%s", result, expected)
+	}
+}
+
+func TestSetFieldNames(t *testing.T) {
+	t.Cleanup(func() { _ = setFieldNames("") })
+
+	if err := setFieldNames("timestamp=time, message=msg,logger=component"); err != nil {
+		t.Fatal(err)
+	}
+	if zerolog.TimestampFieldName != "time" || zerolog.MessageFieldName != "msg" || nameField != "component" {
+		t.Errorf("fields not renamed: %s %s %s", zerolog.TimestampFieldName, zerolog.MessageFieldName, nameField)
+	}
+	if zerolog.LevelFieldName != "level" {
+		t.Errorf("level field = %s, expected the default", zerolog.LevelFieldName)
+	}
+
+	for _, list := range []string{"timestamp", "severity=sev", "level="} {
+		if err := setFieldNames(list); err == nil {
+			t.Errorf("%q accepted", list)
+		}
+	}
+}
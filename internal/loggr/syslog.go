@@ -0,0 +1,30 @@
+//go:build !windows && !plan9
+
+package loggr
+
+import (
+	"io"
+	"log/syslog"
+
+	"github.com/rs/zerolog"
+)
+
+// openSyslog connects to the local syslog daemon, on socket when given, passing the levels on as priorities
+func openSyslog(socket string) (io.Writer, error) {
+	priority := syslog.LOG_INFO | syslog.LOG_DAEMON
+	if socket == "" {
+		w, err := syslog.New(priority, "tsproxy")
+		if err != nil {
+			return nil, err
+		}
+		return zerolog.SyslogLevelWriter(w), nil
+	}
+
+	w, err := syslog.Dial("unixgram", socket, priority, "tsproxy")
+	if err != nil {
+		if w, err = syslog.Dial("unix", socket, priority, "tsproxy"); err != nil {
+			return nil, err
+		}
+	}
+	return zerolog.SyslogLevelWriter(w), nil
+}
@@ -1,30 +1,35 @@
 package loggr
 
 import (
-	"os"
-	"time"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strconv"
 
 	"github.com/go-logr/logr"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
+// Logger is a logr.LogSink writing through zerolog
 type Logger struct {
 	enabled bool
+	name    string
 	zlogger zerolog.Logger
+
+	// depth is the number of frames between the caller and logr.Logger, see WithCallDepth
+	depth int
 }
 
+// nameField holds the name of the logger, "name" is left for the values of the caller
+var nameField = "logger"
+
+// logrFrames is the number of frames between Info or Error and the caller, for logr.Logger
+const logrFrames = 2
+
 func init() {
-	if fileInfo, _ := os.Stdout.Stat(); (fileInfo.Mode() & os.ModeCharDevice) != 0 {
-		zerolog.TimeFieldFormat = zerolog.TimeFormatUnixMs
-		log.Logger = log.Output(zerolog.ConsoleWriter{
-			Out:        os.Stdout,
-			TimeFormat: "15:04:05.999",
-		})
-	} else {
-		zerolog.TimeFieldFormat = time.RFC3339Nano
-		zerolog.TimestampFieldName = "ts"
-	}
+	// the defaults write to stdout, which can not fail
+	_ = Configure()
 }
 
 func New() logr.LogSink {
@@ -34,72 +39,77 @@ func New() logr.LogSink {
 	}
 }
 
-func (l Logger) Enabled(_ int) bool {
-	return l.enabled
+func (l Logger) Enabled(level int) bool {
+	return l.enabled && vLevel(level) >= threshold(l.name)
 }
 
 func (l Logger) Init(_ logr.RuntimeInfo) {
 }
 
+// print adds the logger name, the caller and keysAndValues to e and writes it
 func (l Logger) print(e *zerolog.Event, msg string, keysAndValues ...interface{}) {
+	if l.name != "" {
+		e.Str(nameField, l.name)
+	}
+	// print is called from Info or Error
+	if _, file, line, ok := runtime.Caller(logrFrames + 1 + l.depth); ok {
+		e.Str(zerolog.CallerFieldName, filepath.Base(filepath.Dir(file))+"/"+filepath.Base(file)+":"+strconv.Itoa(line))
+	}
+	eachPair(keysAndValues, func(key string, value interface{}) {
+		e.Any(key, value)
+	})
+	e.Msg(msg)
+}
 
+// eachPair calls fn with each key and value. Keys that are not strings are formatted,
+// and a key without a value gets a placeholder, like logr's funcr.
+func eachPair(keysAndValues []interface{}, fn func(key string, value interface{})) {
 	for i := 0; i < len(keysAndValues); i += 2 {
-		e.Any(keysAndValues[i].(string), keysAndValues[i+1])
+		key, ok := keysAndValues[i].(string)
+		if !ok {
+			key = fmt.Sprintf("<non-string-key: %v>", keysAndValues[i])
+		}
+		var value interface{} = "<no-value>"
+		if i+1 < len(keysAndValues) {
+			value = keysAndValues[i+1]
+		}
+		fn(key, value)
 	}
-	e.Msg(msg)
 }
 
-func (l Logger) Info(_ int, msg string, keysAndValues ...interface{}) {
-	if !l.enabled {
+func (l Logger) Info(level int, msg string, keysAndValues ...interface{}) {
+	if !l.Enabled(level) {
 		return
 	}
-	e := log.Info()
-	l.print(e, msg, keysAndValues...)
+	l.print(l.zlogger.WithLevel(vLevel(level)), msg, keysAndValues...)
 }
 
 func (l Logger) Error(err error, msg string, keysAndValues ...interface{}) {
-	if !l.enabled {
+	if !l.enabled || threshold(l.name) > zerolog.ErrorLevel {
 		return
 	}
-	e := log.Error().Err(err)
-	l.print(e, msg, keysAndValues...)
-}
-
-func (l Logger) V(level int) logr.LogSink {
-	return l
+	l.print(l.zlogger.Error().Err(err), msg, keysAndValues...)
 }
 
 func (l Logger) WithValues(keysAndValues ...interface{}) logr.LogSink {
-	var l2 = l.zlogger.With().Logger()
-
-	l2.UpdateContext(func(c zerolog.Context) zerolog.Context {
-		for i := 0; i < len(keysAndValues); i += 2 {
-			c = c.Any(keysAndValues[i].(string), keysAndValues[i+1])
-		}
-		return c
+	c := l.zlogger.With()
+	eachPair(keysAndValues, func(key string, value interface{}) {
+		c = c.Any(key, value)
 	})
-
-	return Logger{
-		enabled: l.enabled,
-		zlogger: l2,
-	}
+	l.zlogger = c.Logger()
+	return l
 }
 
 func (l Logger) WithName(name string) logr.LogSink {
-	var l2 = l.zlogger.With().Logger()
-
-	l2.UpdateContext(func(c zerolog.Context) zerolog.Context {
-		c = c.Str("name", name)
-		return c
-	})
-
-	return Logger{
-		enabled: l.enabled,
-		zlogger: l2,
+	if l.name != "" {
+		name = l.name + "." + name
 	}
+	l.name = name
+	return l
 }
 
 func (l Logger) WithCallDepth(depth int) logr.LogSink {
+	l.depth += depth
 	return l
 }
 
@@ -0,0 +1,124 @@
+package loggr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/rs/zerolog"
+)
+
+// newTest returns a logger writing JSON lines to the returned buffer
+func newTest() (logr.Logger, *bytes.Buffer) {
+	var buf bytes.Buffer
+	return logr.New(Logger{enabled: true, zlogger: zerolog.New(&buf)}), &buf
+}
+
+func decode(t *testing.T, buf *bytes.Buffer) map[string]interface{} {
+	t.Helper()
+	var fields map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &fields); err != nil {
+		t.Fatalf("invalid log line %q: %v", buf.String(), err)
+	}
+	buf.Reset()
+	return fields
+}
+
+func TestWithValuesAndName(t *testing.T) {
+	logger, buf := newTest()
+	logger = logger.WithName("controller").WithValues("reconcileID", "abc").WithName("tsproxy")
+
+	logger.WithValues("namespace", "default").Info("Reconciling", "name", "web")
+	fields := decode(t, buf)
+	for key, expected := range map[string]interface{}{
+		"logger":      "controller.tsproxy",
+		"reconcileID": "abc",
+		"namespace":   "default",
+		"name":        "web",
+		"message":     "Reconciling",
+		"level":       "info",
+	} {
+		if fields[key] != expected {
+			t.Errorf("%s = %v, expected %v", key, fields[key], expected)
+		}
+	}
+
+	logger.Error(errors.New("failed"), "Reconcile failed")
+	fields = decode(t, buf)
+	if fields["reconcileID"] != "abc" || fields["error"] != "failed" || fields["level"] != "error" {
+		t.Errorf("unexpected error line %v", fields)
+	}
+}
+
+func TestBadKeys(t *testing.T) {
+	logger, buf := newTest()
+
+	logger.Info("Odd", 42, "answer", "dangling")
+	fields := decode(t, buf)
+	if fields["<non-string-key: 42>"] != "answer" {
+		t.Errorf("non-string key not formatted: %v", fields)
+	}
+	if fields["dangling"] != "<no-value>" {
+		t.Errorf("key without value not kept: %v", fields)
+	}
+
+	logger.WithValues(struct{}{}).Info("Values")
+	if fields := decode(t, buf); fields["<non-string-key: {}>"] != "<no-value>" {
+		t.Errorf("bad key in values not kept: %v", fields)
+	}
+}
+
+func TestCaller(t *testing.T) {
+	logger, buf := newTest()
+
+	_, file, line, _ := runtime.Caller(0)
+	logger.Info("Here")
+	expected := "loggr/zlog_test.go:" + strconv.Itoa(line+1)
+	if fields := decode(t, buf); fields["caller"] != expected {
+		t.Errorf("caller = %v, expected %v (%s)", fields["caller"], expected, file)
+	}
+
+	helper := func(logger logr.Logger) {
+		logger.WithCallDepth(1).Info("From helper")
+	}
+	_, _, line, _ = runtime.Caller(0)
+	helper(logger)
+	expected = "loggr/zlog_test.go:" + strconv.Itoa(line+1)
+	if fields := decode(t, buf); fields["caller"] != expected {
+		t.Errorf("caller with depth = %v, expected %v", fields["caller"], expected)
+	}
+}
+
+func TestVerbosity(t *testing.T) {
+	t.Cleanup(func() {
+		SetLevel(zerolog.InfoLevel)
+		ResetNameLevel("controller")
+	})
+	logger, buf := newTest()
+
+	logger.V(1).Info("Debug")
+	if buf.Len() != 0 {
+		t.Errorf("V(1) logged at info level: %s", buf.String())
+	}
+
+	SetNameLevel("controller", zerolog.DebugLevel)
+	logger.WithName("controller").WithName("tsproxy").V(1).Info("Debug")
+	if fields := decode(t, buf); fields["level"] != "debug" {
+		t.Errorf("level = %v, expected debug", fields["level"])
+	}
+	logger.WithName("other").V(1).Info("Debug")
+	if buf.Len() != 0 {
+		t.Errorf("override applied to another logger: %s", buf.String())
+	}
+
+	SetLevel(zerolog.ErrorLevel)
+	logger.Info("Info")
+	logger.Error(nil, "Error")
+	if fields := decode(t, buf); fields["message"] != "Error" {
+		t.Errorf("unexpected line %v", fields)
+	}
+}
@@ -3,6 +3,7 @@ package metrics
 import (
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
@@ -19,6 +20,11 @@ type metricsExporter struct {
 	connectionsActive *prometheus.GaugeVec
 
 	listeners *prometheus.GaugeVec
+	throttled *prometheus.CounterVec
+	rejected  *prometheus.CounterVec
+
+	adminActions    *prometheus.CounterVec
+	adminTerminated *prometheus.CounterVec
 }
 
 var me = &metricsExporter{}
@@ -43,15 +49,39 @@ func initMetrics() {
 	me.connectionsActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "tsproxy_connection_active",
 		Help: "Active connections",
-	}, []string{"namespace", "name", "port", "exposed_as"})
+	}, []string{"namespace", "name", "port", "exposed_as", "target"})
 	_ = metrics.Registry.Register(me.connectionsActive)
 
 	me.listeners = prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Name: "tsproxy_listener_active",
 		Help: "Active listeners",
-	}, []string{"namespace", "name", "port", "exposed_as"})
+	}, []string{"namespace", "name", "port", "exposed_as", "target"})
 	_ = metrics.Registry.Register(me.listeners)
 
+	me.throttled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsproxy_throttled_seconds_total",
+		Help: "Time connections waited for the bandwidth limits, by direction",
+	}, []string{"namespace", "name", "port", "exposed_as", "target", "direction"})
+	_ = metrics.Registry.Register(me.throttled)
+
+	me.rejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsproxy_client_rejected_total",
+		Help: "Connections rejected when accepted, by reason: rate, concurrency or table_full of the client limits, or draining",
+	}, []string{"namespace", "name", "port", "exposed_as", "target", "reason"})
+	_ = metrics.Registry.Register(me.rejected)
+
+	me.adminActions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsproxy_admin_actions_total",
+		Help: "Admin actions, by action and result",
+	}, []string{"action", "result"})
+	_ = metrics.Registry.Register(me.adminActions)
+
+	me.adminTerminated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "tsproxy_admin_terminated_connections_total",
+		Help: "Connections terminated by admin actions",
+	}, []string{"action"})
+	_ = metrics.Registry.Register(me.adminTerminated)
+
 	me.initDone = true
 }
 
@@ -93,9 +123,19 @@ func ConnectionClosed(vec []string) {
 	me.connectionsActive.WithLabelValues(vec...).Dec()
 }
 
-func CreateListenerVec(ns, name string, svcPort, tgtPort int32) []string {
+// CreateListenerVec returns the label values of a listener.
+// svcPort is the port label of the target and target its kind: service, external or pods.
+func CreateListenerVec(ns, name, svcPort string, tgtPort, count int32, target string) []string {
 	initMetrics()
-	return []string{ns, name, strconv.Itoa(int(svcPort)), strconv.Itoa(int(tgtPort))}
+	return []string{ns, name, svcPort, PortLabel(tgtPort, count), target}
+}
+
+// PortLabel formats a port, or a range of count ports starting at port
+func PortLabel(port, count int32) string {
+	if count <= 1 {
+		return strconv.Itoa(int(port))
+	}
+	return strconv.Itoa(int(port)) + "-" + strconv.Itoa(int(port+count-1))
 }
 
 func ListenerOpened(vec []string) {
@@ -106,4 +146,30 @@ func ListenerOpened(vec []string) {
 func ListenerClosed(vec []string) {
 	initMetrics()
 	me.listeners.DeleteLabelValues(vec...)
+	me.throttled.DeletePartialMatch(listenerLabels(vec))
+	me.rejected.DeletePartialMatch(listenerLabels(vec))
+}
+
+// listenerLabels returns the labels of a listener, to match all series of one listener
+func listenerLabels(vec []string) prometheus.Labels {
+	return prometheus.Labels{"namespace": vec[0], "name": vec[1], "port": vec[2], "exposed_as": vec[3], "target": vec[4]}
+}
+
+// ClientRejected counts a connection to a listener rejected by the client limits
+func ClientRejected(vec []string, reason string) {
+	initMetrics()
+	me.rejected.WithLabelValues(append(vec[:len(vec):len(vec)], reason)...).Inc()
+}
+
+// Throttled adds the time a connection of a listener waited for its bandwidth limits
+func Throttled(vec []string, direction string, d time.Duration) {
+	initMetrics()
+	me.throttled.WithLabelValues(append(vec[:len(vec):len(vec)], direction)...).Add(d.Seconds())
+}
+
+// AdminAction counts an admin action and the connections it terminated
+func AdminAction(action, result string, terminated int) {
+	initMetrics()
+	me.adminActions.WithLabelValues(action, result).Inc()
+	me.adminTerminated.WithLabelValues(action).Add(float64(terminated))
 }
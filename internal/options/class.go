@@ -0,0 +1,9 @@
+package options
+
+// HandlesClass reports whether TSProxies with proxyClassName name are handled by this instance
+func HandlesClass(name string) bool {
+	if name == "" {
+		return Flags.ProxyClass == "" || Flags.DefaultClass
+	}
+	return name == Flags.ProxyClass
+}
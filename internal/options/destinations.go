@@ -0,0 +1,131 @@
+package options
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Destination is an external host, wildcard domain (*.example.com) or network,
+// optionally limited to a range of ports
+type Destination struct {
+	Host    string
+	Network *net.IPNet
+	Ports   PortRange
+}
+
+// ParseDestination parses "host", "*.domain", "ip" or "cidr", optionally followed by ":port" or ":min-max".
+// IPv6 addresses with ports are written in brackets, e.g. [2001:db8::/32]:5432
+func ParseDestination(s string) (Destination, error) {
+	var d Destination
+
+	s = strings.TrimSpace(s)
+	host, ports := s, ""
+	if strings.HasPrefix(s, "[") {
+		end := strings.Index(s, "]")
+		if end < 0 {
+			return d, fmt.Errorf("invalid destination %q", s)
+		}
+		host, ports = s[1:end], strings.TrimPrefix(s[end+1:], ":")
+	} else if strings.Count(s, ":") == 1 {
+		host, ports, _ = strings.Cut(s, ":")
+	}
+
+	if ports != "" {
+		pr, err := ParsePortRange(ports)
+		if err != nil {
+			return d, fmt.Errorf("invalid destination %q: %w", s, err)
+		}
+		d.Ports = pr
+	}
+
+	if _, network, err := net.ParseCIDR(host); err == nil {
+		d.Network = network
+		return d, nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		bits := 8 * len(ip.To16())
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		d.Network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		return d, nil
+	}
+	if host == "" || strings.Contains(strings.TrimPrefix(host, "*."), "*") {
+		return d, fmt.Errorf("invalid destination %q", s)
+	}
+
+	d.Host = strings.ToLower(host)
+	return d, nil
+}
+
+// Allows reports whether the count ports from port on host are permitted by the destination.
+// Hostnames are never resolved, so they only match host and wildcard destinations.
+func (d Destination) Allows(host string, port, count int32) bool {
+	if !d.Ports.IsZero() && !(d.Ports.Contains(port) && d.Ports.Contains(port+count-1)) {
+		return false
+	}
+
+	if d.Network != nil {
+		ip := net.ParseIP(host)
+		return ip != nil && d.Network.Contains(ip)
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if domain, wildcard := strings.CutPrefix(d.Host, "*."); wildcard {
+		return strings.HasSuffix(host, "."+domain)
+	}
+	return host == d.Host
+}
+
+func (d Destination) String() string {
+	var host = d.Host
+	if d.Network != nil {
+		host = d.Network.String()
+		if ones, bits := d.Network.Mask.Size(); ones == bits {
+			host = d.Network.IP.String()
+		}
+	}
+	if d.Ports.IsZero() {
+		return host
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return host + ":" + d.Ports.String()
+}
+
+// Destinations is a list of external destinations, usable as a comma separated flag value
+type Destinations []Destination
+
+func (l Destinations) Allows(host string, port, count int32) bool {
+	for _, d := range l {
+		if d.Allows(host, port, count) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l Destinations) String() string {
+	var parts = make([]string, 0, len(l))
+	for _, d := range l {
+		parts = append(parts, d.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// Set appends the comma separated destinations in s
+func (l *Destinations) Set(s string) error {
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		d, err := ParseDestination(part)
+		if err != nil {
+			return err
+		}
+		*l = append(*l, d)
+	}
+	return nil
+}
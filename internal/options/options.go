@@ -1,6 +1,90 @@
 package options
 
+import "time"
+
 var Flags struct {
 	Debug     bool
 	Keepalive bool
+
+	// HalfCloseTimeout is how long the other direction may be idle after one direction reached EOF, zero closes at once
+	HalfCloseTimeout time.Duration
+
+	// LogFormat is the format of the log: json, console, logfmt, or auto for console on a terminal
+	LogFormat string
+
+	// LogOutput is where the log is written: stdout, stderr, syslog, syslog:<socket> or a file path
+	LogOutput string
+
+	// LogMaxSize is the size in megabytes at which a log file is rotated, zero never rotates
+	LogMaxSize int
+
+	// LogMaxBackups is the number of rotated log files kept
+	LogMaxBackups int
+
+	// LogMaxAge removes rotated log files older than this, zero keeps them
+	LogMaxAge time.Duration
+
+	// LogTimeFormat is the format of the log timestamps: rfc3339nano, rfc3339, unix, unixms, unixmicro, unixnano or a layout
+	LogTimeFormat string
+
+	// LogFieldNames renames the standard log fields, e.g. timestamp=time,message=msg
+	LogFieldNames string
+
+	// AccessLog is where a record of each connection is written: stdout, stderr, a file path or none
+	AccessLog string
+
+	// AccessLogMaxSize is the size in megabytes at which an access log file is rotated, zero never rotates
+	AccessLogMaxSize int
+
+	// AccessLogMaxBackups is the number of rotated access log files kept
+	AccessLogMaxBackups int
+
+	// PortRange is where ports are allocated for services without exposeAs
+	PortRange PortRange
+
+	// AllowedPorts limits the ports that may be exposed, empty allows all
+	AllowedPorts PortRanges
+
+	// ReservedPorts may never be exposed
+	ReservedPorts PortRanges
+
+	// AllowedExternal lists the external destinations services may target, empty allows none
+	AllowedExternal Destinations
+
+	// WaitForTarget keeps the ports of services with a missing target closed
+	WaitForTarget bool
+
+	// ClientTableSize is the number of client IPs tracked per listener for the client limits
+	ClientTableSize int
+
+	// EnforcePolicies requires namespaces to be selected by a TSProxyPolicy
+	EnforcePolicies bool
+
+	// WatchNamespaces limits the controller to these namespaces, empty watches all.
+	// Targets in other namespaces are read without the cache.
+	WatchNamespaces []string
+
+	// WatchNamespaceSelector limits the controller to namespaces with matching labels, resolved at startup
+	WatchNamespaceSelector string
+
+	// EnableWebhooks registers the admission webhooks
+	EnableWebhooks bool
+
+	// AdminAddr is the address of the admin API, empty or "0" disables it
+	AdminAddr string
+
+	// AdminTokenFile holds the bearer token required for admin actions, empty disables them
+	AdminTokenFile string
+
+	// ProxyClass is the proxyClassName of the TSProxies handled by this instance
+	ProxyClass string
+
+	// DefaultClass also handles TSProxies without a proxyClassName
+	DefaultClass bool
+
+	// NodeName is the node this instance runs on, set when running per node
+	NodeName string
+
+	// ConfigFile runs the proxy standalone from the TSProxies in this file, instead of the Kubernetes API
+	ConfigFile string
 }
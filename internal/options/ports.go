@@ -0,0 +1,100 @@
+package options
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PortRange is an inclusive range of port numbers, usable as a flag value
+type PortRange struct {
+	Min int32
+	Max int32
+}
+
+// ParsePortRange parses "min-max" or a single port number
+func ParsePortRange(s string) (PortRange, error) {
+	var r PortRange
+
+	lo, hi, isRange := strings.Cut(strings.TrimSpace(s), "-")
+	if !isRange {
+		hi = lo
+	}
+
+	first, err := strconv.ParseInt(strings.TrimSpace(lo), 10, 32)
+	if err != nil {
+		return r, fmt.Errorf("invalid port range %q: %w", s, err)
+	}
+	last, err := strconv.ParseInt(strings.TrimSpace(hi), 10, 32)
+	if err != nil {
+		return r, fmt.Errorf("invalid port range %q: %w", s, err)
+	}
+	if first < 1 || last > 65535 || first > last {
+		return r, fmt.Errorf("invalid port range %q", s)
+	}
+
+	r.Min, r.Max = int32(first), int32(last)
+	return r, nil
+}
+
+func (r PortRange) IsZero() bool {
+	return r.Min == 0 && r.Max == 0
+}
+
+func (r PortRange) Contains(port int32) bool {
+	return !r.IsZero() && port >= r.Min && port <= r.Max
+}
+
+func (r PortRange) String() string {
+	if r.IsZero() {
+		return ""
+	}
+	if r.Min == r.Max {
+		return strconv.Itoa(int(r.Min))
+	}
+	return fmt.Sprintf("%d-%d", r.Min, r.Max)
+}
+
+func (r *PortRange) Set(s string) error {
+	parsed, err := ParsePortRange(s)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// PortRanges is a list of port ranges, usable as a comma separated flag value
+type PortRanges []PortRange
+
+func (r PortRanges) Contains(port int32) bool {
+	for _, pr := range r {
+		if pr.Contains(port) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r PortRanges) String() string {
+	var parts = make([]string, 0, len(r))
+	for _, pr := range r {
+		parts = append(parts, pr.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// Set appends the comma separated ranges in s
+func (r *PortRanges) Set(s string) error {
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		pr, err := ParsePortRange(part)
+		if err != nil {
+			return err
+		}
+		*r = append(*r, pr)
+	}
+	return nil
+}
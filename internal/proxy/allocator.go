@@ -0,0 +1,156 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+	"github.com/AB-Lindex/tsproxy/internal/options"
+)
+
+var (
+	errNoPortRange = errors.New("exposeAs is required when no port range is configured")
+	errNoFreePort  = errors.New("no free port left in the port range")
+)
+
+// Restore registers the ports allocated to a TSProxy in an earlier run,
+// so they are not handed out to anyone else before the TSProxy is reloaded
+func Restore(key types.NamespacedName, status proxyv1alpha1.TSProxyStatus) {
+	tsp.mutex.Lock()
+	defer tsp.mutex.Unlock()
+
+	for _, svc := range status.Services {
+		for port := svc.ExposeAs; port < svc.ExposeAs+max(svc.Count, 1); port++ {
+			if !options.Flags.PortRange.Contains(port) {
+				continue
+			}
+			if _, taken := tsp.allocated[port]; !taken {
+				tsp.allocated[port] = key.String()
+			}
+		}
+	}
+}
+
+// allocate returns a copy of obj where every service without exposeAs has ports from the port range.
+// Ports already reported in the status are kept. The errors are in the same order as the services.
+func (m *manager) allocate(ctx context.Context, objKey string, obj *proxyv1alpha1.TSProxy) (*proxyv1alpha1.TSProxy, []error) {
+	logger := log.FromContext(ctx)
+
+	var errs = make([]error, len(obj.Spec.Services))
+	var keep = make(map[int32]bool)
+
+	obj = obj.DeepCopy()
+	for i := range obj.Spec.Services {
+		svc := &obj.Spec.Services[i]
+		if svc.ExposeAs != 0 {
+			continue
+		}
+		if options.Flags.PortRange.IsZero() {
+			errs[i] = errNoPortRange
+			continue
+		}
+
+		count := svc.PortCount()
+		port := m.previousPort(objKey, obj, svc)
+		if port == 0 {
+			port = m.freePort(objKey, obj, count)
+		}
+		if port == 0 {
+			errs[i] = errNoFreePort
+			continue
+		}
+
+		if m.allocated[port] != objKey {
+			logger.Info("Allocated port", "service", svc.Name, "port", port, "count", count)
+		}
+		for p := port; p < port+count; p++ {
+			m.allocated[p] = objKey
+			keep[p] = true
+		}
+		svc.ExposeAs = port
+	}
+
+	m.releaseAllocations(objKey, keep)
+
+	return obj, errs
+}
+
+// previousPort returns the first port reported in the status for svc, if the ports can still be used
+func (m *manager) previousPort(objKey string, obj *proxyv1alpha1.TSProxy, svc *proxyv1alpha1.TSProxyService) int32 {
+	for _, st := range obj.Status.Services {
+		if st.Name != svc.Name || st.ServicePort != svc.ServicePort || st.Count != svc.Count || st.ExposeAs == 0 {
+			continue
+		}
+		if m.isAvailable(objKey, obj.Namespace, obj, st.ExposeAs, svc.PortCount(), true) {
+			return st.ExposeAs
+		}
+	}
+	return 0
+}
+
+// freePort returns the first port of the lowest block of count ports in the range
+// that are neither allocated nor claimed, also by the other services of obj, and allowed for its namespace
+func (m *manager) freePort(objKey string, obj *proxyv1alpha1.TSProxy, count int32) int32 {
+	r := options.Flags.PortRange
+	for port := r.Min; port+count-1 <= r.Max; port++ {
+		if m.isAvailable(objKey, obj.Namespace, obj, port, count, false) {
+			return port
+		}
+	}
+	return 0
+}
+
+// isAvailable reports whether the count ports from port are in the range and free to be allocated to objKey
+// in namespace. Ports already allocated to objKey are only accepted if own is set.
+func (m *manager) isAvailable(objKey, namespace string, obj *proxyv1alpha1.TSProxy, port, count int32, own bool) bool {
+	for p := port; p < port+count; p++ {
+		if !options.Flags.PortRange.Contains(p) || checkAllowed(p, 1) != nil || !m.policyAllows(namespace, p) {
+			return false
+		}
+		if owner, taken := m.allocated[p]; taken && (owner != objKey || !own) {
+			return false
+		}
+		if m.isClaimed(objKey, obj, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// isClaimed reports whether port is bound by or explicitly requested by any TSProxy but objKey,
+// or requested by another service of obj
+func (m *manager) isClaimed(objKey string, obj *proxyv1alpha1.TSProxy, port int32) bool {
+	if conn, found := m.ports[port]; found && conn.proxyservice.key.String() != objKey {
+		return true
+	}
+	for key, ps := range m.active {
+		if key == objKey || ps.obj == nil {
+			continue
+		}
+		for i := range ps.obj.Spec.Services {
+			if overlaps(&ps.obj.Spec.Services[i], port, 1) {
+				return true
+			}
+		}
+	}
+	if obj != nil {
+		for i := range obj.Spec.Services {
+			if overlaps(&obj.Spec.Services[i], port, 1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// releaseAllocations frees the ports allocated to objKey that are not in keep
+func (m *manager) releaseAllocations(objKey string, keep map[int32]bool) {
+	for port, owner := range m.allocated {
+		if owner == objKey && !keep[port] {
+			delete(m.allocated, port)
+		}
+	}
+}
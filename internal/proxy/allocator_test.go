@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+	"github.com/AB-Lindex/tsproxy/internal/options"
+)
+
+// setup gives the test an empty manager, closing its listeners and restoring the global one,
+// the flags and the notify function afterwards
+func setup(t *testing.T) *manager {
+	t.Helper()
+
+	saved, flags, notified := tsp, options.Flags, notify
+	tsp = newManager()
+	t.Cleanup(func() {
+		for _, ps := range tsp.active {
+			ps.Close(context.Background())
+		}
+		tsp, options.Flags, notify = saved, flags, notified
+	})
+	return tsp
+}
+
+func newTSProxy(namespace, name string, services ...proxyv1alpha1.TSProxyService) *proxyv1alpha1.TSProxy {
+	return &proxyv1alpha1.TSProxy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       proxyv1alpha1.TSProxySpec{Services: services},
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	var tests = []struct {
+		name     string
+		services []proxyv1alpha1.TSProxyService
+		want     []int32
+	}{
+		{
+			name: "lowest free port",
+			services: []proxyv1alpha1.TSProxyService{
+				{Name: "a", ServicePort: 80},
+			},
+			want: []int32{41000},
+		},
+		{
+			name: "skips the explicit ports of the same TSProxy",
+			services: []proxyv1alpha1.TSProxyService{
+				{Name: "explicit", ServicePort: 80, ExposeAs: 41000},
+				{Name: "auto", ServicePort: 81},
+			},
+			want: []int32{41000, 41001},
+		},
+		{
+			name: "skips an explicit range declared later",
+			services: []proxyv1alpha1.TSProxyService{
+				{Name: "auto", ServicePort: 81},
+				{Name: "explicit", ServicePort: 80, ExposeAs: 41000, Count: 3},
+			},
+			want: []int32{41003, 41000},
+		},
+		{
+			name: "blocks do not overlap",
+			services: []proxyv1alpha1.TSProxyService{
+				{Name: "a", ServicePort: 80, Count: 4},
+				{Name: "b", ServicePort: 90, Count: 2},
+			},
+			want: []int32{41000, 41004},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := setup(t)
+			options.Flags.PortRange = options.PortRange{Min: 41000, Max: 41010}
+
+			obj, errs := m.allocate(context.Background(), "a/x", newTSProxy("a", "x", tt.services...))
+			for i, svc := range obj.Spec.Services {
+				if errs[i] != nil {
+					t.Fatalf("service %s: %v", svc.Name, errs[i])
+				}
+				if svc.ExposeAs != tt.want[i] {
+					t.Errorf("service %s: exposeAs = %d, want %d", svc.Name, svc.ExposeAs, tt.want[i])
+				}
+			}
+			if errs, _ := m.checkServices("a/x", obj); firstError(errs) != nil {
+				t.Errorf("allocated ports conflict: %v", firstError(errs))
+			}
+		})
+	}
+}
+
+func TestAllocateExhausted(t *testing.T) {
+	m := setup(t)
+	options.Flags.PortRange = options.PortRange{Min: 41000, Max: 41001}
+
+	obj := newTSProxy("a", "x",
+		proxyv1alpha1.TSProxyService{Name: "explicit", ServicePort: 80, ExposeAs: 41001},
+		proxyv1alpha1.TSProxyService{Name: "auto", ServicePort: 81, Count: 2},
+	)
+	_, errs := m.allocate(context.Background(), "a/x", obj)
+	if errs[1] != errNoFreePort {
+		t.Errorf("got %v, want %v", errs[1], errNoFreePort)
+	}
+}
@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"errors"
+	"net"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+)
+
+// target kinds, used in the logs and as the target label of the metrics
+const (
+	targetService  = "service"
+	targetExternal = "external"
+	targetPods     = "pods"
+)
+
+var errNoBackends = errors.New("no ready pods to connect to")
+
+// Backend is a pod selected by a service, with the port its first port is mapped to
+type Backend struct {
+	IP   string
+	Port int32
+}
+
+// SetBackends sets the ready pods of svc, a service with a selector in the TSProxy key.
+// They are kept by the key of the listener, as names of services need not be unique.
+// Running listeners pick up the new backends on the next reload of the TSProxy.
+func SetBackends(key types.NamespacedName, svc *proxyv1alpha1.TSProxyService, backends []Backend) {
+	tsp.mutex.Lock()
+	defer tsp.mutex.Unlock()
+
+	services := tsp.backends[key]
+	if services == nil {
+		services = make(map[string][]Backend)
+		tsp.backends[key] = services
+	}
+	services[serviceKey(key.Namespace, svc)] = backends
+}
+
+// targetKind returns the kind of target of svc in a TSProxy in namespace ns
+func (m *manager) targetKind(ns string, svc *proxyv1alpha1.TSProxyService) string {
+	switch {
+	case svc.Selector != nil:
+		return targetPods
+	case m.externalHost(ns, svc) != "":
+		return targetExternal
+	default:
+		return targetService
+	}
+}
+
+func (conn *listener) setBackends(backends []Backend) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	conn.backends = backends
+}
+
+// nextBackend returns the address of the next ready pod, round robin, for the port at offset in the range
+func (conn *listener) nextBackend(offset int32) (string, error) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	if len(conn.backends) == 0 {
+		return "", errNoBackends
+	}
+	conn.next = (conn.next + 1) % len(conn.backends)
+	b := conn.backends[conn.next]
+	return net.JoinHostPort(b.IP, strconv.Itoa(int(b.Port+offset))), nil
+}
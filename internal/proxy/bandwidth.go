@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+	"github.com/AB-Lindex/tsproxy/internal/metrics"
+)
+
+// directions of the data proxied, indexing the limiters
+const (
+	upload   = iota // from the client to the target
+	download        // from the target to the client
+)
+
+var directions = [2]string{"upload", "download"}
+
+// limiters are the token buckets of both directions, one token per byte
+type limiters [2]*rate.Limiter
+
+func newLimiters() limiters {
+	return limiters{rate.NewLimiter(rate.Inf, 0), rate.NewLimiter(rate.Inf, 0)}
+}
+
+// set changes the limits to the bytes per second of r, unlimited when r or a direction is omitted
+func (l limiters) set(r *proxyv1alpha1.TSProxyRate) {
+	var quantities [2]*resource.Quantity
+	if r != nil {
+		quantities = [2]*resource.Quantity{r.Upload, r.Download}
+	}
+
+	for dir, q := range quantities {
+		limit, burst := rate.Inf, 0
+		if q != nil && q.Value() > 0 {
+			// a second of data may be sent at once
+			limit, burst = rate.Limit(q.Value()), int(q.Value())
+		}
+		if l[dir].Limit() == limit {
+			continue
+		}
+		// the burst first, so a limited bucket never has a burst of zero
+		l[dir].SetBurst(burst)
+		l[dir].SetLimit(limit)
+	}
+}
+
+// setBandwidth changes the limits of the listener and of its open connections
+func (conn *listener) setBandwidth(b *proxyv1alpha1.TSProxyBandwidth) {
+	var perConnection, perListener *proxyv1alpha1.TSProxyRate
+	if b != nil {
+		perConnection, perListener = b.PerConnection, b.PerListener
+	}
+	conn.limiters.set(perListener)
+
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	conn.perConnection = perConnection
+	for _, c := range conn.connections {
+		c.limiters.set(perConnection)
+	}
+}
+
+// throttle waits for the token buckets of the connection and of its listener before writing through.
+// Writes larger than a burst are split. Waiting ends with an error when ctx is done.
+type throttle struct {
+	ctx        context.Context
+	w          io.Writer
+	limiters   [2]*rate.Limiter
+	metricsVec []string
+	direction  string
+}
+
+func (t *throttle) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := p
+		limited := false
+		for _, l := range t.limiters {
+			if l.Limit() == rate.Inf {
+				continue
+			}
+			limited = true
+			if len(chunk) > l.Burst() {
+				chunk = chunk[:l.Burst()]
+			}
+		}
+
+		if limited {
+			start := time.Now()
+			if err := t.wait(len(chunk)); err != nil {
+				if t.ctx.Err() != nil {
+					return written, t.ctx.Err()
+				}
+				// the limits changed meanwhile, split again
+				continue
+			}
+			metrics.Throttled(t.metricsVec, t.direction, time.Since(start))
+		}
+
+		n, err := t.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// limited reports whether any of the token buckets has a limit
+func (t *throttle) limited() bool {
+	for _, l := range t.limiters {
+		if l.Limit() != rate.Inf {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *throttle) wait(n int) error {
+	for _, l := range t.limiters {
+		if err := l.WaitN(t.ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
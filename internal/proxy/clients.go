@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"container/list"
+	"net"
+	"sync"
+
+	"golang.org/x/time/rate"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+	"github.com/AB-Lindex/tsproxy/internal/options"
+)
+
+// reasons a connection is rejected when accepted, used in the metrics
+const (
+	rejectRate        = "rate"
+	rejectConcurrency = "concurrency"
+	rejectTableFull   = "table_full"
+	rejectDraining    = "draining"
+)
+
+// clientTable tracks the connection rate and open connections of each client IP of a listener.
+// At most --client-table-size clients are tracked, idle clients are evicted least recently used first.
+type clientTable struct {
+	mutex   sync.Mutex
+	limits  *proxyv1alpha1.TSProxyClientLimits
+	clients map[string]*client
+
+	// idle holds the clients without open connections, most recently used first
+	idle *list.List
+}
+
+type client struct {
+	ip      string
+	limiter *rate.Limiter
+	active  int32
+	idle    *list.Element
+}
+
+// setLimits changes the limits, keeping the open connections of the tracked clients.
+// Without limits nothing is tracked, so when they are turned on the open connections are counted
+// from open, the client IPs of the live connections of the listener.
+func (t *clientTable) setLimits(limits *proxyv1alpha1.TSProxyClientLimits, open []string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if limits == nil {
+		t.limits, t.clients, t.idle = nil, nil, nil
+		return
+	}
+	if t.clients == nil {
+		t.clients = make(map[string]*client)
+		t.idle = list.New()
+		for _, ip := range open {
+			c := t.clients[ip]
+			if c == nil {
+				c = &client{ip: ip}
+				t.clients[ip] = c
+			}
+			c.active++
+		}
+	}
+	if t.limits != nil && *t.limits == *limits {
+		return
+	}
+
+	t.limits = limits.DeepCopy()
+	for _, c := range t.clients {
+		c.limiter = t.newLimiter()
+	}
+}
+
+func (t *clientTable) newLimiter() *rate.Limiter {
+	if t.limits.ConnectionsPerSecond < 1 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(t.limits.ConnectionsPerSecond), int(t.limits.ConnectionsPerSecond))
+}
+
+// admit counts a new connection from ip, or returns why it is rejected
+func (t *clientTable) admit(ip string) string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.limits == nil {
+		return ""
+	}
+
+	c := t.clients[ip]
+	if c == nil {
+		if len(t.clients) >= max(options.Flags.ClientTableSize, 1) {
+			oldest := t.idle.Back()
+			if oldest == nil {
+				return rejectTableFull
+			}
+			t.remove(oldest.Value.(*client))
+		}
+		c = &client{ip: ip, limiter: t.newLimiter()}
+		c.idle = t.idle.PushFront(c)
+		t.clients[ip] = c
+	}
+
+	reason := ""
+	switch {
+	case t.limits.MaxConnections > 0 && c.active >= t.limits.MaxConnections:
+		reason = rejectConcurrency
+	case c.limiter != nil && !c.limiter.Allow():
+		reason = rejectRate
+	}
+	if reason != "" {
+		if c.idle != nil {
+			t.idle.MoveToFront(c.idle)
+		}
+		return reason
+	}
+
+	c.active++
+	if c.idle != nil {
+		t.idle.Remove(c.idle)
+		c.idle = nil
+	}
+	return ""
+}
+
+// release counts a closed connection from ip
+func (t *clientTable) release(ip string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	c := t.clients[ip]
+	if c == nil || c.active == 0 {
+		return
+	}
+	c.active--
+	if c.active == 0 {
+		c.idle = t.idle.PushFront(c)
+	}
+}
+
+func (t *clientTable) remove(c *client) {
+	if c.idle != nil {
+		t.idle.Remove(c.idle)
+	}
+	delete(t.clients, c.ip)
+}
+
+// clientIP returns the IP address of the client of an accepted connection
+func clientIP(accepted net.Conn) string {
+	host, _, err := net.SplitHostPort(accepted.RemoteAddr().String())
+	if err != nil {
+		return accepted.RemoteAddr().String()
+	}
+	return host
+}
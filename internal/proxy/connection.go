@@ -5,8 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
 	"github.com/AB-Lindex/tsproxy/internal/metrics"
 	"github.com/AB-Lindex/tsproxy/internal/options"
 	"sigs.k8s.io/controller-runtime/pkg/log"
@@ -19,12 +23,25 @@ type listener struct {
 	name         string
 	svcPort      int32
 	exposeAsPort int32
+	count        int32
 	connectTo    string
+	kind         string
 
-	listener    net.Listener
+	listeners   []net.Listener
 	connections map[int]*connection
+	backends    []Backend
+	next        int
 	mutex       sync.Mutex
 
+	// limiters limit all connections together, perConnection is applied to each new connection
+	limiters      limiters
+	perConnection *proxyv1alpha1.TSProxyRate
+
+	clients clientTable
+
+	// draining is above zero while connections are drained, new connections are then closed at once
+	draining atomic.Int32
+
 	metricsVec []string
 }
 
@@ -32,42 +49,97 @@ var netListener = net.ListenConfig{
 	KeepAliveConfig: keepalive,
 }
 
-func makeConnectionKey(ns, name string, svcPort, tgtPort int32) string {
-	return fmt.Sprintf("%s/%s/%d/%d", ns, name, svcPort, tgtPort)
+func makeConnectionKey(ns, name, svcPort string, tgtPort, count int32) string {
+	return fmt.Sprintf("%s/%s/%s/%s", ns, name, svcPort, metrics.PortLabel(tgtPort, count))
+}
+
+// servicePortLabel returns the port name or the ports proxied on the target of svc
+func servicePortLabel(svc *proxyv1alpha1.TSProxyService) string {
+	if svc.PortName != "" {
+		return svc.PortName
+	}
+	return metrics.PortLabel(svc.ServicePort, svc.PortCount())
 }
 
-func newListener(ps *proxyservice, ctx context.Context, ns, name string, svcPort, tgtPort int32) *listener {
+// serviceKey returns the key of the listener for a service of a TSProxy in namespace ns
+func serviceKey(ns string, svc *proxyv1alpha1.TSProxyService) string {
+	name := svc.Name
+	switch {
+	case svc.Host != "":
+		name += "@" + svc.Host
+	case svc.Selector != nil:
+		name += "@" + targetPods
+	}
+	return makeConnectionKey(targetNamespace(ns, svc), name, servicePortLabel(svc), svc.ExposeAs, svc.PortCount())
+}
+
+func newListener(ps *proxyservice, ctx context.Context, svc *proxyv1alpha1.TSProxyService) *listener {
 	logger := log.FromContext(ctx)
 
-	key := makeConnectionKey(ns, name, svcPort, tgtPort)
+	// the metrics and the log show the namespace of the TSProxy, the target may be in another
+	ns := ps.key.Namespace
+	targetNs := targetNamespace(ns, svc)
+	key := serviceKey(ns, svc)
+
+	kind := tsp.targetKind(ns, svc)
+	connectTo := fmt.Sprintf("%s.%s", svc.Name, targetNs)
+	switch {
+	case kind == targetPods:
+		connectTo = ""
+	case svc.Host != "":
+		connectTo = svc.Host
+	}
 
-	mvec := metrics.CreateListenerVec(ns, name, svcPort, tgtPort)
+	mvec := metrics.CreateListenerVec(ns, svc.Name, servicePortLabel(svc), svc.ExposeAs, svc.PortCount(), kind)
 
-	logger.Info("New listener", "key", key, "namespace", ns, "name", name, "port", tgtPort)
+	logger.Info("New listener", "key", key, "namespace", ns, "name", svc.Name, "port", svc.ExposeAs, "count", svc.PortCount(),
+		"target", connectTo, "targetNamespace", targetNs, "kind", kind)
 
 	conn := &listener{
 		proxyservice: ps,
 		key:          key,
 		namespace:    ns,
-		name:         name,
-		svcPort:      svcPort,
-		exposeAsPort: tgtPort,
+		name:         svc.Name,
+		svcPort:      tsp.servicePort(ns, svc),
+		exposeAsPort: svc.ExposeAs,
+		count:        svc.PortCount(),
 		metricsVec:   mvec,
-		connectTo:    fmt.Sprintf("%s.%s:%d", name, ns, svcPort),
+		connectTo:    connectTo,
+		kind:         kind,
+		backends:     tsp.backends[ps.key][key],
+		limiters:     newLimiters(),
 	}
+	conn.setBandwidth(svc.Bandwidth)
+	conn.setClientLimits(svc.ClientLimits)
 
 	return conn
 }
 
+// target returns the backend address for the port at offset in the range
+func (conn *listener) target(offset int32) (string, error) {
+	if conn.kind == targetPods {
+		return conn.nextBackend(offset)
+	}
+
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	return net.JoinHostPort(conn.connectTo, strconv.Itoa(int(conn.svcPort+offset))), nil
+}
+
 func (conn *listener) Close(ctx context.Context) {
 	logger := log.FromContext(ctx)
 
 	logger.Info("Closing connection", "key", conn.key)
 
-	_ = conn.listener.Close()
+	for _, l := range conn.listeners {
+		_ = l.Close()
+	}
 
 	delete(conn.proxyservice.listeners, conn.key)
-	delete(tsp.ports, conn.exposeAsPort)
+	for offset := int32(0); offset < conn.count; offset++ {
+		delete(tsp.ports, conn.exposeAsPort+offset)
+	}
+	tsp.portReleased(conn.exposeAsPort, conn.count, conn.proxyservice)
 
 	metrics.ListenerClosed(conn.metricsVec)
 }
@@ -87,7 +159,9 @@ func (conn *listener) Start(ctx context.Context) error {
 		"key", conn.key,
 		"namespace", conn.namespace,
 		"name", conn.name,
-		"port", conn.exposeAsPort)
+		"port", conn.exposeAsPort,
+		"count", conn.count,
+		"kind", conn.kind)
 
 	// // connect to service
 	// connsvc, err := net.Dial("tcp", fmt.Sprintf("%s.%s:%d", conn.name, conn.namespace, conn.svcPort))
@@ -97,31 +171,39 @@ func (conn *listener) Start(ctx context.Context) error {
 	// }
 	// conn.svcConn = connsvc
 
-	// listen on target port
-	listener, err := listen(conn.exposeAsPort)
+	// listen on target ports, all or none
+	listeners := make([]net.Listener, 0, conn.count)
+	for offset := int32(0); offset < conn.count; offset++ {
+		listener, err := listen(conn.exposeAsPort + offset)
 
-	if err != nil {
-		logger.Error(err, "Failed to listen on target port")
-		return err
+		if err != nil {
+			logger.Error(err, "Failed to listen on target port", "port", conn.exposeAsPort+offset)
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, listener)
 	}
-	conn.listener = listener
-
-	tsp.ports[conn.exposeAsPort] = conn
+	conn.listeners = listeners
 
-	go conn.Accept(metrics.NextWorker())
+	for offset, listener := range listeners {
+		tsp.ports[conn.exposeAsPort+int32(offset)] = conn
+		go conn.Accept(metrics.NextWorker(), listener, int32(offset))
+	}
 
 	metrics.ListenerOpened(conn.metricsVec)
 
 	return nil
 }
 
-func (conn *listener) Accept(workerID int) {
+func (conn *listener) Accept(workerID int, listener net.Listener, offset int32) {
 	logger := log.FromContext(context.Background())
 	defer logger.Info("Listener closed", "worker", workerID)
-	logger.Info("Accepting connections", "key", conn.key, "worker", workerID)
+	logger.Info("Accepting connections", "key", conn.key, "worker", workerID, "port", conn.exposeAsPort+offset)
 
 	for {
-		accepted, err := conn.listener.Accept()
+		accepted, err := listener.Accept()
 		if err != nil {
 			if errors.Is(err, net.ErrClosed) {
 				logger.Error(err, "Listener closed", "key", conn.key)
@@ -131,18 +213,54 @@ func (conn *listener) Accept(workerID int) {
 			continue
 		}
 
-		connect, err := newConnection(conn.proxyservice, conn, accepted)
+		started := time.Now()
+		if conn.draining.Load() > 0 {
+			metrics.ClientRejected(conn.metricsVec, rejectDraining)
+			conn.reject(accepted, started, "", reasonRejected, rejectDraining)
+			continue
+		}
+
+		ip := clientIP(accepted)
+		if reason := conn.clients.admit(ip); reason != "" {
+			metrics.ClientRejected(conn.metricsVec, reason)
+			conn.reject(accepted, started, "", reasonRejected, reason)
+			continue
+		}
+
+		target, err := conn.target(offset)
 		if err != nil {
-			logger.Error(err, "Failed to create connection", "key", conn.key)
+			logger.Error(err, "No target for connection", "key", conn.key, "kind", conn.kind)
+			conn.clients.release(ip)
+			conn.reject(accepted, started, "", reasonNoBackend, err.Error())
+			continue
+		}
+
+		connect, err := newConnection(conn.proxyservice, conn, accepted, target)
+		if err != nil {
+			logger.Error(err, "Failed to create connection", "key", conn.key, "target", target, "kind", conn.kind)
+			conn.clients.release(ip)
 			continue
 		}
 
 		a, b := metrics.NextDualWorker()
+		connect.workers = [2]int{a, b}
 		conn.AddConnection(a, connect)
 		connect.Run(a, b)
 	}
 }
 
+// setClientLimits changes the client limits, counting the live connections when they are turned on
+func (conn *listener) setClientLimits(limits *proxyv1alpha1.TSProxyClientLimits) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	var open = make([]string, 0, len(conn.connections))
+	for _, c := range conn.connections {
+		open = append(open, clientIP(c.inbound))
+	}
+	conn.clients.setLimits(limits, open)
+}
+
 func (conn *listener) AddConnection(id int, c *connection) {
 	conn.mutex.Lock()
 	defer conn.mutex.Unlock()
@@ -150,6 +268,7 @@ func (conn *listener) AddConnection(id int, c *connection) {
 	if conn.connections == nil {
 		conn.connections = make(map[int]*connection)
 	}
+	c.limiters.set(conn.perConnection)
 	conn.connections[id] = c
 
 	metrics.ConnectionOpened(conn.metricsVec)
@@ -159,11 +278,13 @@ func (conn *listener) RemoveConnection(id int) {
 	conn.mutex.Lock()
 	defer conn.mutex.Unlock()
 
-	if _, found := conn.connections[id]; !found {
+	c, found := conn.connections[id]
+	if !found {
 		return
 	}
 
 	metrics.ConnectionClosed(conn.metricsVec)
+	conn.clients.release(clientIP(c.inbound))
 
 	delete(conn.connections, id)
 }
@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"fmt"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+	"github.com/AB-Lindex/tsproxy/internal/metrics"
+	"github.com/AB-Lindex/tsproxy/internal/options"
+)
+
+// externalHost returns the external host targeted by svc of a TSProxy in namespace ns,
+// or "" when it targets a service in the cluster
+func (m *manager) externalHost(ns string, svc *proxyv1alpha1.TSProxyService) string {
+	if svc.Host != "" {
+		return svc.Host
+	}
+	if svc.Selector != nil {
+		return ""
+	}
+	if service := m.services[targetKey(ns, svc)]; service != nil {
+		return service.ExternalName
+	}
+	return ""
+}
+
+// checkExternal verifies that an external target of svc is an allowed external destination
+func (m *manager) checkExternal(ns string, svc *proxyv1alpha1.TSProxyService) error {
+	host := m.externalHost(ns, svc)
+	if host == "" || options.Flags.ConfigFile != "" {
+		// the targets of a local config file are trusted
+		return nil
+	}
+	return checkDestination(host, m.servicePort(ns, svc), svc.PortCount())
+}
+
+func checkDestination(host string, port, count int32) error {
+	if !options.Flags.AllowedExternal.Allows(host, port, count) {
+		return &deniedError{reason: fmt.Sprintf("external target %s:%s is not an allowed external destination",
+			host, metrics.PortLabel(port, count))}
+	}
+	return nil
+}
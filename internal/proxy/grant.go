@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"fmt"
+	"slices"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+)
+
+// Grant permits TSProxies of other namespaces to target services in the namespace of the grant
+type Grant struct {
+	// Name of the TSProxyGrant, used in messages
+	Name string
+
+	// Namespaces whose TSProxies are permitted
+	Namespaces []string
+
+	// Services that may be targeted, empty allows all.
+	// When set, pod selectors are denied as their name is not a Service of the namespace.
+	Services []string
+}
+
+// SetGrants sets the grants of a namespace, replacing any earlier grants
+func SetGrants(namespace string, grants []Grant) {
+	tsp.mutex.Lock()
+	defer tsp.mutex.Unlock()
+
+	if len(grants) == 0 {
+		delete(tsp.grants, namespace)
+		return
+	}
+	tsp.grants[namespace] = grants
+}
+
+// targetNamespace returns the namespace of the service targeted by svc of a TSProxy in namespace ns
+func targetNamespace(ns string, svc *proxyv1alpha1.TSProxyService) string {
+	if svc.Namespace != "" {
+		return svc.Namespace
+	}
+	return ns
+}
+
+// checkGrant verifies that a TSProxy in namespace ns may target the service of svc
+func (m *manager) checkGrant(ns string, svc *proxyv1alpha1.TSProxyService) error {
+	target := targetNamespace(ns, svc)
+	if target == ns {
+		return nil
+	}
+
+	for _, grant := range m.grants[target] {
+		if !slices.Contains(grant.Namespaces, ns) {
+			continue
+		}
+		if len(grant.Services) == 0 {
+			return nil
+		}
+		if svc.Selector == nil && slices.Contains(grant.Services, svc.Name) {
+			return nil
+		}
+	}
+	if svc.Selector != nil {
+		return &deniedError{reason: fmt.Sprintf("no TSProxyGrant in namespace %s permits namespace %s to select pods",
+			target, ns)}
+	}
+	return &deniedError{reason: fmt.Sprintf("no TSProxyGrant in namespace %s permits namespace %s to target service %s",
+		target, ns, svc.Name)}
+}
@@ -0,0 +1,86 @@
+package proxy
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+)
+
+func TestCheckGrant(t *testing.T) {
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "db"}}
+
+	var tests = []struct {
+		name    string
+		grants  []Grant
+		svc     proxyv1alpha1.TSProxyService
+		allowed bool
+	}{
+		{
+			name:    "same namespace",
+			svc:     proxyv1alpha1.TSProxyService{Name: "web"},
+			allowed: true,
+		},
+		{
+			name: "no grant",
+			svc:  proxyv1alpha1.TSProxyService{Name: "web", Namespace: "b"},
+		},
+		{
+			name:    "all services",
+			grants:  []Grant{{Namespaces: []string{"a"}}},
+			svc:     proxyv1alpha1.TSProxyService{Name: "web", Namespace: "b"},
+			allowed: true,
+		},
+		{
+			name:   "other namespace",
+			grants: []Grant{{Namespaces: []string{"c"}}},
+			svc:    proxyv1alpha1.TSProxyService{Name: "web", Namespace: "b"},
+		},
+		{
+			name:    "listed service",
+			grants:  []Grant{{Namespaces: []string{"a"}, Services: []string{"web"}}},
+			svc:     proxyv1alpha1.TSProxyService{Name: "web", Namespace: "b"},
+			allowed: true,
+		},
+		{
+			name:   "unlisted service",
+			grants: []Grant{{Namespaces: []string{"a"}, Services: []string{"web"}}},
+			svc:    proxyv1alpha1.TSProxyService{Name: "db", Namespace: "b"},
+		},
+		{
+			name:    "selector with all services",
+			grants:  []Grant{{Namespaces: []string{"a"}}},
+			svc:     proxyv1alpha1.TSProxyService{Name: "db", Namespace: "b", Selector: selector},
+			allowed: true,
+		},
+		{
+			name:   "selector named like a listed service",
+			grants: []Grant{{Namespaces: []string{"a"}, Services: []string{"web"}}},
+			svc:    proxyv1alpha1.TSProxyService{Name: "web", Namespace: "b", Selector: selector},
+		},
+		{
+			name: "selector with a second grant for all services",
+			grants: []Grant{
+				{Namespaces: []string{"a"}, Services: []string{"web"}},
+				{Namespaces: []string{"a"}},
+			},
+			svc:     proxyv1alpha1.TSProxyService{Name: "web", Namespace: "b", Selector: selector},
+			allowed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := setup(t)
+			if tt.grants != nil {
+				m.grants["b"] = tt.grants
+			}
+
+			err := m.checkGrant("a", &tt.svc)
+			if allowed := err == nil; allowed != tt.allowed {
+				t.Errorf("allowed = %v, want %v (%v)", allowed, tt.allowed, err)
+			}
+		})
+	}
+}
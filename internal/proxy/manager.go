@@ -2,12 +2,15 @@ package proxy
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
 
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+	"github.com/AB-Lindex/tsproxy/internal/metrics"
 	"github.com/AB-Lindex/tsproxy/internal/options"
 )
 
@@ -17,22 +20,58 @@ const (
 )
 
 type manager struct {
-	active map[string]*proxyservice
-	ports  map[int32]*listener
+	// mutex guards the manager against the admin API, the exported functions hold it
+	mutex sync.Mutex
+
+	active    map[string]*proxyservice
+	ports     map[int32]*listener
+	allocated map[int32]string
+	policies  map[string]*NamespacePolicy
+	peers     map[string][]*proxyv1alpha1.TSProxy
+	grants    map[string][]Grant
+
+	services map[types.NamespacedName]*Service
+	backends map[types.NamespacedName]map[string][]Backend
 }
 
 type proxyservice struct {
 	key       types.NamespacedName
 	obj       *proxyv1alpha1.TSProxy
 	listeners map[string]*listener
+
+	// services is the state of each service after the last reload
+	services []proxyv1alpha1.TSProxyServiceStatus
 }
 
-var tsp = &manager{
-	active: make(map[string]*proxyservice),
-	ports:  make(map[int32]*listener),
+var tsp = newManager()
+
+func newManager() *manager {
+	return &manager{
+		active:    make(map[string]*proxyservice),
+		ports:     make(map[int32]*listener),
+		allocated: make(map[int32]string),
+		policies:  make(map[string]*NamespacePolicy),
+		peers:     make(map[string][]*proxyv1alpha1.TSProxy),
+		grants:    make(map[string][]Grant),
+
+		services: make(map[types.NamespacedName]*Service),
+		backends: make(map[types.NamespacedName]map[string][]Backend),
+	}
 }
 
-func Reload(ctx context.Context, key types.NamespacedName, obj *proxyv1alpha1.TSProxy) {
+// notify is called with the key of every TSProxy that needs to be reloaded
+// because another TSProxy changed which ports it holds
+var notify = func(types.NamespacedName) {}
+
+// OnChange registers fn to be called for TSProxies that need to be reloaded
+func OnChange(fn func(key types.NamespacedName)) {
+	notify = fn
+}
+
+func Reload(ctx context.Context, key types.NamespacedName, obj *proxyv1alpha1.TSProxy) []proxyv1alpha1.TSProxyServiceStatus {
+	tsp.mutex.Lock()
+	defer tsp.mutex.Unlock()
+
 	if options.Flags.Debug {
 		defer tsp.Dump(ctx)
 	}
@@ -46,11 +85,27 @@ func Reload(ctx context.Context, key types.NamespacedName, obj *proxyv1alpha1.TS
 	logger.Info("Reload", "namespace", key.Namespace, "name", key.Name)
 
 	if obj == nil {
+		delete(tsp.backends, key)
 		tsp.Close(ctx, key.String())
-		return
+		return nil
 	}
 
-	tsp.AddOrUpdate(ctx, key, obj)
+	services := tsp.AddOrUpdate(ctx, key, obj)
+	if ps, ok := tsp.active[key.String()]; ok {
+		ps.refreshTargets(ctx)
+		ps.services = services
+	}
+	return services
+}
+
+// conflictError is returned when a port is owned by another TSProxy
+type conflictError struct {
+	port  int32
+	owner string
+}
+
+func (e *conflictError) Error() string {
+	return fmt.Sprintf("ExposeAs %d is already in use by %s", e.port, e.owner)
 }
 
 func (m *manager) IsPortAvailable(port int32) bool {
@@ -59,32 +114,223 @@ func (m *manager) IsPortAvailable(port int32) bool {
 }
 
 func (m *manager) Validate(ctx context.Context, objKey string, obj *proxyv1alpha1.TSProxy) error {
+	errs, _ := m.checkServices(objKey, obj)
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkServices validates each service of obj, returning the errors in the same order as the services,
+// and the listeners of younger TSProxies that must yield their port to obj
+func (m *manager) checkServices(objKey string, obj *proxyv1alpha1.TSProxy) ([]error, []*listener) {
+	var errs = make([]error, len(obj.Spec.Services))
+	var evict []*listener
+	var seen = make(map[int32]bool)
+	var used = m.namespaceUsage(objKey, obj)
+
+	for i := range obj.Spec.Services {
+		var yield []*listener
+		if errs[i] = m.checkGrant(obj.Namespace, &obj.Spec.Services[i]); errs[i] != nil {
+			continue
+		}
+		if errs[i] = m.checkPortName(obj.Namespace, &obj.Spec.Services[i]); errs[i] != nil {
+			continue
+		}
+		if errs[i] = m.checkExternal(obj.Namespace, &obj.Spec.Services[i]); errs[i] != nil {
+			continue
+		}
+		if options.Flags.WaitForTarget {
+			key := types.NamespacedName{Namespace: obj.Namespace, Name: obj.Name}
+			if errs[i] = m.resolveTarget(key, &obj.Spec.Services[i]); errs[i] != nil {
+				continue
+			}
+		}
+		yield, errs[i] = m.checkPorts(objKey, obj, &obj.Spec.Services[i], seen)
+		if errs[i] == nil {
+			errs[i] = used.claim(obj.Namespace, &obj.Spec.Services[i])
+		}
+		if errs[i] == nil {
+			evict = append(evict, yield...)
+		}
+	}
+
+	return errs, evict
+}
 
-	for _, svc := range obj.Spec.Services {
-		if svc.ExposeAs < PORTNO_MIN || svc.ExposeAs > PORTNO_MAX {
-			return fmt.Errorf("ExposeAs %d is out of range", svc.ExposeAs)
+// checkPorts validates all ports exposed by svc as a unit,
+// returning the listeners of younger TSProxies that must yield to obj
+func (m *manager) checkPorts(objKey string, obj *proxyv1alpha1.TSProxy, svc *proxyv1alpha1.TSProxyService,
+	seen map[int32]bool) ([]*listener, error) {
+	count := svc.PortCount()
+
+	if svc.ExposeAs < PORTNO_MIN || svc.ExposeAs+count-1 > PORTNO_MAX {
+		return nil, fmt.Errorf("ExposeAs %s is out of range", metrics.PortLabel(svc.ExposeAs, count))
+	}
+	if svc.PortName == "" && (svc.ServicePort < PORTNO_MIN || svc.ServicePort+count-1 > PORTNO_MAX) {
+		return nil, fmt.Errorf("Port %s is out of range", metrics.PortLabel(svc.ServicePort, count))
+	}
+	if err := checkAllowed(svc.ExposeAs, count); err != nil {
+		return nil, err
+	}
+
+	for port := svc.ExposeAs; port < svc.ExposeAs+count; port++ {
+		if seen[port] {
+			return nil, &conflictError{port: port, owner: "another service in " + objKey}
 		}
+	}
 
-		if activeListener, found := m.ports[svc.ExposeAs]; found {
+	var yield []*listener
+	for port := svc.ExposeAs; port < svc.ExposeAs+count; port++ {
+		if activeListener, found := m.ports[port]; found {
 			if activeListener == nil {
 				panic("activeListener is nil")
 			}
 			if activeListener.proxyservice == nil {
 				panic("activeListener.proxyservice is nil")
 			}
-			if activeListener.proxyservice.key.String() != objKey {
-				return fmt.Errorf("ExposeAs %d is already in use by %s", svc.ExposeAs, activeListener.proxyservice.key)
+			if owner := activeListener.proxyservice; owner.key.String() != objKey {
+				if !hasPriority(obj, objKey, owner) {
+					return nil, &conflictError{port: port, owner: owner.key.String()}
+				}
+				yield = append(yield, activeListener)
 			}
 		}
 	}
 
-	return nil
+	for port := svc.ExposeAs; port < svc.ExposeAs+count; port++ {
+		seen[port] = true
+	}
+
+	return yield, nil
+}
+
+// hasPriority reports whether obj wins a contested port over owner.
+// The oldest creationTimestamp wins and ties are broken by namespace/name,
+// so the outcome does not depend on the order of reconciles.
+func hasPriority(obj *proxyv1alpha1.TSProxy, objKey string, owner *proxyservice) bool {
+	if owner.obj == nil {
+		return true
+	}
+	return older(obj, objKey, owner.obj, owner.key.String())
+}
+
+// older reports whether a, with key aKey, was created before b, with key bKey
+func older(a *proxyv1alpha1.TSProxy, aKey string, b *proxyv1alpha1.TSProxy, bKey string) bool {
+	ta, tb := a.CreationTimestamp, b.CreationTimestamp
+	if !ta.Equal(&tb) {
+		return ta.Before(&tb)
+	}
+	return aKey < bKey
+}
+
+// evict closes listeners whose ports are claimed by an older TSProxy, returning all listeners closed.
+// An Atomic owner gives up all of its listeners.
+func (m *manager) evict(ctx context.Context, listeners []*listener) []*listener {
+	logger := log.FromContext(ctx)
+
+	var closed []*listener
+	for _, conn := range listeners {
+		if m.ports[conn.exposeAsPort] != conn {
+			// already closed as part of a range or an Atomic owner
+			continue
+		}
+
+		owner := conn.proxyservice
+		logger.Info("Port claimed by an older TSProxy - yielding", "key", conn.key, "port", conn.exposeAsPort, "owner", owner.key)
+		if owner.obj != nil && owner.obj.Spec.ApplyPolicy == proxyv1alpha1.ApplyAtomic {
+			for _, c := range owner.listeners {
+				c.Close(ctx)
+				closed = append(closed, c)
+			}
+		} else {
+			conn.Close(ctx)
+			closed = append(closed, conn)
+		}
+	}
+	return closed
+}
+
+// settleEvicted restarts the evicted listeners whose ports were not bound after all,
+// as when the claiming Atomic TSProxy rolled back, and notifies the owners of the others.
+// An Atomic owner is only restarted when all of its listeners can be.
+func (m *manager) settleEvicted(ctx context.Context, closed []*listener) {
+	logger := log.FromContext(ctx)
+
+	var owners []*proxyservice
+	var byOwner = make(map[*proxyservice][]*listener)
+	for _, conn := range closed {
+		if _, found := byOwner[conn.proxyservice]; !found {
+			owners = append(owners, conn.proxyservice)
+		}
+		byOwner[conn.proxyservice] = append(byOwner[conn.proxyservice], conn)
+	}
+
+	for _, owner := range owners {
+		var restore, lost []*listener
+		for _, conn := range byOwner[owner] {
+			if m.portsFree(conn.exposeAsPort, conn.count) {
+				restore = append(restore, conn)
+			} else {
+				lost = append(lost, conn)
+			}
+		}
+		if len(lost) > 0 && owner.obj != nil && owner.obj.Spec.ApplyPolicy == proxyv1alpha1.ApplyAtomic {
+			restore = nil
+		}
+
+		for _, conn := range restore {
+			logger.Info("Port not claimed after all - restarting", "key", conn.key, "port", conn.exposeAsPort, "owner", owner.key)
+			if err := conn.Start(ctx); err != nil {
+				lost = append(lost, conn)
+				continue
+			}
+			owner.listeners[conn.key] = conn
+		}
+		if len(lost) > 0 {
+			notify(owner.key)
+		}
+	}
+}
+
+// portsFree reports whether none of the count ports from port is bound
+func (m *manager) portsFree(port, count int32) bool {
+	for p := port; p < port+count; p++ {
+		if _, found := m.ports[p]; found {
+			return false
+		}
+	}
+	return true
+}
+
+// portReleased notifies every TSProxy, except the previous owner, waiting for any of the count ports from port
+func (m *manager) portReleased(port, count int32, owner *proxyservice) {
+	for _, ps := range m.active {
+		if ps == owner || ps.obj == nil {
+			continue
+		}
+		for i := range ps.obj.Spec.Services {
+			if overlaps(&ps.obj.Spec.Services[i], port, count) {
+				notify(ps.key)
+				break
+			}
+		}
+	}
+}
+
+// overlaps reports whether svc exposes any of the count ports from port
+func overlaps(svc *proxyv1alpha1.TSProxyService, port, count int32) bool {
+	return svc.ExposeAs != 0 && svc.ExposeAs < port+count && port < svc.ExposeAs+svc.PortCount()
 }
 
 // manager functions
 func (m *manager) Close(ctx context.Context, key string) {
 	logger := log.FromContext(ctx)
 
+	m.releaseAllocations(key, nil)
+
 	if _, ok := m.active[key]; !ok {
 		logger.Info("TSProxy not found in active list")
 		return
@@ -97,23 +343,41 @@ func (m *manager) Close(ctx context.Context, key string) {
 	}
 }
 
-func (m *manager) AddOrUpdate(ctx context.Context, key types.NamespacedName, obj *proxyv1alpha1.TSProxy) {
+func (m *manager) AddOrUpdate(ctx context.Context, key types.NamespacedName, obj *proxyv1alpha1.TSProxy) []proxyv1alpha1.TSProxyServiceStatus {
 	logger := log.FromContext(ctx)
 
-	if err := m.Validate(ctx, key.String(), obj); err != nil {
-		logger.Error(err, "TSProxy validation failed", "namespace", key.Namespace, "name", key.Name)
-		return
+	obj, allocErrs := m.allocate(ctx, key.String(), obj)
+	errs, evict := m.checkServices(key.String(), obj)
+	errs = mergeErrors(allocErrs, errs)
+
+	if ps, ok := m.active[key.String()]; ok {
+		ps.closeDenied(ctx, obj.Spec.Services, errs)
+	}
+
+	if obj.Spec.ApplyPolicy == proxyv1alpha1.ApplyAtomic {
+		if err := firstError(errs); err != nil {
+			logger.Error(err, "TSProxy validation failed", "namespace", key.Namespace, "name", key.Name)
+			ps := m.active[key.String()]
+			if ps == nil {
+				ps = m.add(ctx, key, obj)
+			}
+			return ps.status(obj.Spec.Services, rejectRemaining(errs, err))
+		}
 	}
 
+	// evicted listeners are restarted if obj does not bind their ports, as when an Atomic apply rolls back
+	evicted := m.evict(ctx, evict)
+	defer m.settleEvicted(ctx, evicted)
+
 	if ps, ok := m.active[key.String()]; ok {
-		m.update(ctx, key, obj, ps)
-		return
+		return m.update(ctx, key, obj, ps, errs)
 	}
 
-	m.add(ctx, key, obj)
+	ps := m.add(ctx, key, obj)
+	return ps.status(obj.Spec.Services, ps.Start(ctx, errs))
 }
 
-func (m *manager) add(ctx context.Context, key types.NamespacedName, obj *proxyv1alpha1.TSProxy) {
+func (m *manager) add(ctx context.Context, key types.NamespacedName, obj *proxyv1alpha1.TSProxy) *proxyservice {
 	logger := log.FromContext(ctx)
 
 	logger.Info("Adding new proxy", "namespace", key.Namespace, "name", key.Name)
@@ -123,42 +387,116 @@ func (m *manager) add(ctx context.Context, key types.NamespacedName, obj *proxyv
 		listeners: make(map[string]*listener),
 	}
 	m.active[key.String()] = svc
-	svc.Start(ctx)
+	return svc
 }
 
-func (m *manager) update(ctx context.Context, key types.NamespacedName, obj *proxyv1alpha1.TSProxy, ps *proxyservice) {
+func (m *manager) update(ctx context.Context, key types.NamespacedName, obj *proxyv1alpha1.TSProxy, ps *proxyservice, errs []error) []proxyv1alpha1.TSProxyServiceStatus {
 	logger := log.FromContext(ctx)
 
 	logger.Info("Updating existing proxy", "namespace", key.Namespace, "name", key.Name)
+	ps.obj = obj
 
 	var inUse = make(map[string]bool)
 	for key := range ps.listeners {
 		inUse[key] = true
 	}
 
-	for _, svc := range obj.Spec.Services {
-		key := makeConnectionKey(key.Namespace, svc.Name, svc.ServicePort, svc.ExposeAs)
+	for i := range obj.Spec.Services {
+		key := serviceKey(key.Namespace, &obj.Spec.Services[i])
 		if _, found := inUse[key]; found {
 			logger.Info("Service already running - dont touch", "key", key)
 			delete(inUse, key)
 			continue
 		}
 	}
+
+	var toStart = make([]*proxyv1alpha1.TSProxyService, len(obj.Spec.Services))
+	for i := range obj.Spec.Services {
+		key := serviceKey(key.Namespace, &obj.Spec.Services[i])
+		if _, found := ps.listeners[key]; !found && errs[i] == nil {
+			toStart[i] = &obj.Spec.Services[i]
+		}
+	}
+
+	if obj.Spec.ApplyPolicy == proxyv1alpha1.ApplyAtomic {
+		return ps.status(obj.Spec.Services, ps.applyAtomic(ctx, toStart, inUse))
+	}
+
 	for svc := range inUse {
 		logger.Info("Service no longer in use - closing", "key", svc)
 		ps.listeners[svc].Close(ctx)
-		delete(ps.listeners, svc)
 	}
 
-	var toStart []proxyv1alpha1.TSProxyService
-	for _, svc := range obj.Spec.Services {
-		key := makeConnectionKey(key.Namespace, svc.Name, svc.ServicePort, svc.ExposeAs)
-		if _, found := ps.listeners[key]; !found {
-			toStart = append(toStart, svc)
+	return ps.status(obj.Spec.Services, mergeErrors(errs, ps.beginToListen(ctx, toStart)))
+}
+
+// applyAtomic binds all new ports before closing the listeners no longer in use.
+// If any bind fails the new listeners are closed again and the previous set is restored.
+func (ps *proxyservice) applyAtomic(ctx context.Context, toStart []*proxyv1alpha1.TSProxyService, toClose map[string]bool) []error {
+	logger := log.FromContext(ctx)
+
+	// ports moving between services of this TSProxy must be released first
+	var released []*listener
+	for _, svc := range toStart {
+		if svc == nil {
+			continue
+		}
+		for port := svc.ExposeAs; port < svc.ExposeAs+svc.PortCount(); port++ {
+			if conn, found := tsp.ports[port]; found && toClose[conn.key] {
+				logger.Info("Releasing port for reuse", "key", conn.key, "port", port)
+				conn.Close(ctx)
+				delete(toClose, conn.key)
+				released = append(released, conn)
+			}
+		}
+	}
+
+	errs := ps.beginToListen(ctx, toStart)
+	if err := firstError(errs); err != nil {
+		logger.Error(err, "Atomic apply failed - rolling back", "namespace", ps.key.Namespace, "name", ps.key.Name)
+		for i, svc := range toStart {
+			if svc == nil || errs[i] != nil {
+				continue
+			}
+			ps.listeners[serviceKey(ps.key.Namespace, svc)].Close(ctx)
+		}
+		for _, conn := range released {
+			if err := conn.Start(ctx); err == nil {
+				ps.listeners[conn.key] = conn
+			}
 		}
+		return rejectRemaining(errs, err)
+	}
+
+	for key := range toClose {
+		logger.Info("Service no longer in use - closing", "key", key)
+		ps.listeners[key].Close(ctx)
 	}
 
-	ps.beginToListen(ctx, toStart)
+	return errs
+}
+
+// closeDenied closes running listeners of services no longer permitted by the policies or grants,
+// and of services whose target disappeared when waiting for targets
+func (ps *proxyservice) closeDenied(ctx context.Context, services []proxyv1alpha1.TSProxyService, errs []error) {
+	logger := log.FromContext(ctx)
+
+	for i := range services {
+		var denied *deniedError
+		var unresolved *TargetError
+		switch {
+		case errors.As(errs[i], &denied):
+			if conn, running := ps.listeners[serviceKey(ps.key.Namespace, &services[i])]; running {
+				logger.Info("Service no longer permitted - closing", "key", conn.key, "reason", denied.reason)
+				conn.Close(ctx)
+			}
+		case options.Flags.WaitForTarget && errors.As(errs[i], &unresolved):
+			if conn, running := ps.listeners[serviceKey(ps.key.Namespace, &services[i])]; running {
+				logger.Info("Target no longer resolved - closing", "key", conn.key, "reason", unresolved.Message)
+				conn.Close(ctx)
+			}
+		}
+	}
 }
 
 // service functions
@@ -177,34 +515,152 @@ func (ps *proxyservice) Close(ctx context.Context) bool {
 	return true
 }
 
-func (ps *proxyservice) Start(ctx context.Context) {
+func (ps *proxyservice) Start(ctx context.Context, errs []error) []error {
 	logger := log.FromContext(ctx)
 
 	if ps.obj == nil {
 		logger.Error(nil, "TSProxy object is nil - unable to start")
-		return
+		return errs
 	}
 
 	logger.Info("Starting", "namespace", ps.key.Namespace, "name", ps.key.Name, "services", len(ps.obj.Spec.Services))
-	ps.beginToListen(ctx, ps.obj.Spec.Services)
+
+	var toStart = make([]*proxyv1alpha1.TSProxyService, len(ps.obj.Spec.Services))
+	for i := range ps.obj.Spec.Services {
+		if errs[i] == nil {
+			toStart[i] = &ps.obj.Spec.Services[i]
+		}
+	}
+
+	startErrs := ps.beginToListen(ctx, toStart)
+	if ps.obj.Spec.ApplyPolicy == proxyv1alpha1.ApplyAtomic {
+		if err := firstError(startErrs); err != nil {
+			logger.Error(err, "Atomic start failed - closing", "namespace", ps.key.Namespace, "name", ps.key.Name)
+			for _, conn := range ps.listeners {
+				conn.Close(ctx)
+			}
+			return rejectRemaining(startErrs, err)
+		}
+	}
+
+	return mergeErrors(errs, startErrs)
 }
 
-func (ps *proxyservice) beginToListen(ctx context.Context, services []proxyv1alpha1.TSProxyService) {
+// beginToListen starts a listener for each non-nil service.
+// The returned errors are in the same order as services.
+func (ps *proxyservice) beginToListen(ctx context.Context, services []*proxyv1alpha1.TSProxyService) []error {
 	logger := log.FromContext(ctx)
 
-	var newListeners = make([]*listener, 0, len(services))
+	var errs = make([]error, len(services))
+	var newListeners = make([]*listener, len(services))
 
-	for _, svc := range services {
+	for i, svc := range services {
+		if svc == nil {
+			continue
+		}
 		logger.Info("Starting TSProxy service", "service", svc.Name)
-		conn := newListener(ps, ctx, ps.key.Namespace, svc.Name, svc.ServicePort, svc.ExposeAs)
-		newListeners = append(newListeners, conn)
+		newListeners[i] = newListener(ps, ctx, svc)
 	}
 
-	for _, conn := range newListeners {
-		if err := conn.Start(ctx); err == nil {
-			ps.listeners[conn.key] = conn
+	for i, conn := range newListeners {
+		if conn == nil {
+			continue
 		}
+		if err := conn.Start(ctx); err != nil {
+			errs[i] = err
+			continue
+		}
+		ps.listeners[conn.key] = conn
 	}
+
+	return errs
+}
+
+// status reports the state of each service in the order of services
+func (ps *proxyservice) status(services []proxyv1alpha1.TSProxyService, errs []error) []proxyv1alpha1.TSProxyServiceStatus {
+	var result = make([]proxyv1alpha1.TSProxyServiceStatus, 0, len(services))
+
+	for i := range services {
+		svc := &services[i]
+		st := proxyv1alpha1.TSProxyServiceStatus{
+			Name:        svc.Name,
+			ServicePort: svc.ServicePort,
+			ExposeAs:    svc.ExposeAs,
+			Count:       svc.Count,
+			State:       proxyv1alpha1.ServiceActive,
+		}
+
+		var conflict *conflictError
+		var denied *deniedError
+		key := serviceKey(ps.key.Namespace, svc)
+		switch _, running := ps.listeners[key]; {
+		case running:
+		case errors.As(errs[i], &conflict):
+			st.State = proxyv1alpha1.ServiceConflict
+			st.Message = errs[i].Error()
+		case errors.As(errs[i], &denied):
+			st.State = proxyv1alpha1.ServiceDenied
+			st.Message = errs[i].Error()
+		case errors.As(errs[i], new(*TargetError)):
+			st.State = proxyv1alpha1.ServiceUnresolved
+			st.Message = errs[i].Error()
+		case errors.As(errs[i], new(*rejectedError)):
+			st.State = proxyv1alpha1.ServiceRejected
+			st.Message = errs[i].Error()
+		case errs[i] != nil:
+			st.State = proxyv1alpha1.ServiceFailed
+			st.Message = errs[i].Error()
+		default:
+			st.State = proxyv1alpha1.ServiceFailed
+			st.Message = "not started"
+		}
+
+		result = append(result, st)
+	}
+
+	return result
+}
+
+// rejectedError marks a service that was not applied because of another service
+type rejectedError struct {
+	cause error
+}
+
+func (e *rejectedError) Error() string {
+	return fmt.Sprintf("not applied: %v", e.cause)
+}
+
+// rejectRemaining marks all services without an error as rejected because of cause
+func rejectRemaining(errs []error, cause error) []error {
+	var result = make([]error, len(errs))
+	for i, err := range errs {
+		if err == nil {
+			err = &rejectedError{cause: cause}
+		}
+		result[i] = err
+	}
+	return result
+}
+
+// mergeErrors returns the first non-nil error of each position
+func mergeErrors(a, b []error) []error {
+	var result = make([]error, len(a))
+	for i := range a {
+		result[i] = a[i]
+		if result[i] == nil {
+			result[i] = b[i]
+		}
+	}
+	return result
+}
+
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (m *manager) Dump(ctx context.Context) {
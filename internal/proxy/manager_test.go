@@ -0,0 +1,266 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+	"github.com/AB-Lindex/tsproxy/internal/options"
+)
+
+// the tests bind ports from basePort on all interfaces
+const basePort = 47100
+
+var created = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// aged returns a TSProxy in namespace a created age hours after the others of age 0
+func aged(name string, age int, policy proxyv1alpha1.ApplyPolicy, ports ...int32) *proxyv1alpha1.TSProxy {
+	obj := newTSProxy("a", name)
+	obj.CreationTimestamp = metav1.NewTime(created.Add(time.Duration(age) * time.Hour))
+	obj.Spec.ApplyPolicy = policy
+	for _, port := range ports {
+		obj.Spec.Services = append(obj.Spec.Services, proxyv1alpha1.TSProxyService{
+			Name:        "svc" + strconv.Itoa(int(port)),
+			ServicePort: 80,
+			ExposeAs:    port,
+		})
+	}
+	return obj
+}
+
+// occupy binds port outside the manager until the test ends
+func occupy(t *testing.T, port int32) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", ":"+strconv.Itoa(int(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+}
+
+// owner returns the key of the TSProxy bound to port, empty when it is free
+func owner(m *manager, port int32) string {
+	if conn, found := m.ports[port]; found {
+		return conn.proxyservice.key.String()
+	}
+	return ""
+}
+
+func reload(obj *proxyv1alpha1.TSProxy) []proxyv1alpha1.TSProxyServiceStatus {
+	return Reload(context.Background(), types.NamespacedName{Namespace: obj.Namespace, Name: obj.Name}, obj)
+}
+
+func states(services []proxyv1alpha1.TSProxyServiceStatus) []proxyv1alpha1.ServiceState {
+	var result []proxyv1alpha1.ServiceState
+	for _, st := range services {
+		result = append(result, st.State)
+	}
+	return result
+}
+
+func TestReload(t *testing.T) {
+	const (
+		active   = proxyv1alpha1.ServiceActive
+		conflict = proxyv1alpha1.ServiceConflict
+		failed   = proxyv1alpha1.ServiceFailed
+		rejected = proxyv1alpha1.ServiceRejected
+		partial  = proxyv1alpha1.ApplyPartial
+		atomic   = proxyv1alpha1.ApplyAtomic
+		p0       = basePort
+		p1       = basePort + 1
+		p2       = basePort + 2
+	)
+
+	var tests = []struct {
+		name     string
+		occupied []int32
+		before   []*proxyv1alpha1.TSProxy
+		obj      *proxyv1alpha1.TSProxy
+		want     []proxyv1alpha1.ServiceState
+		owners   map[int32]string
+		notified []string
+	}{
+		{
+			name:   "older TSProxy takes the port",
+			before: []*proxyv1alpha1.TSProxy{aged("young", 1, partial, p0)},
+			obj:    aged("old", 0, partial, p0),
+			want:   []proxyv1alpha1.ServiceState{active},
+			owners: map[int32]string{p0: "a/old"},
+			// the younger TSProxy is reconciled to report the conflict
+			notified: []string{"a/young"},
+		},
+		{
+			name:   "younger TSProxy waits",
+			before: []*proxyv1alpha1.TSProxy{aged("old", 0, partial, p0)},
+			obj:    aged("young", 1, partial, p0, p1),
+			want:   []proxyv1alpha1.ServiceState{conflict, active},
+			owners: map[int32]string{p0: "a/old", p1: "a/young"},
+		},
+		{
+			name:   "equal age is decided by name",
+			before: []*proxyv1alpha1.TSProxy{aged("b", 0, partial, p0)},
+			obj:    aged("a", 0, partial, p0),
+			want:   []proxyv1alpha1.ServiceState{active},
+			owners: map[int32]string{p0: "a/a"},
+		},
+		{
+			name:   "Atomic owner yields all its ports",
+			before: []*proxyv1alpha1.TSProxy{aged("young", 1, atomic, p0, p1)},
+			obj:    aged("old", 0, partial, p0),
+			want:   []proxyv1alpha1.ServiceState{active},
+			owners: map[int32]string{p0: "a/old", p1: ""},
+		},
+		{
+			name:     "Atomic start rolls back",
+			occupied: []int32{p1},
+			obj:      aged("old", 0, atomic, p0, p1),
+			want:     []proxyv1alpha1.ServiceState{rejected, failed},
+			owners:   map[int32]string{p0: ""},
+		},
+		{
+			name:     "eviction is undone when the Atomic start rolls back",
+			occupied: []int32{p1},
+			before:   []*proxyv1alpha1.TSProxy{aged("young", 1, partial, p0)},
+			obj:      aged("old", 0, atomic, p0, p1),
+			want:     []proxyv1alpha1.ServiceState{rejected, failed},
+			owners:   map[int32]string{p0: "a/young"},
+		},
+		{
+			name:     "Atomic owner is restored as a whole",
+			occupied: []int32{p2},
+			before:   []*proxyv1alpha1.TSProxy{aged("young", 1, atomic, p0, p1)},
+			obj:      aged("old", 0, atomic, p0, p2),
+			want:     []proxyv1alpha1.ServiceState{rejected, failed},
+			owners:   map[int32]string{p0: "a/young", p1: "a/young"},
+		},
+		{
+			name:     "Atomic owner is not restored in part",
+			occupied: []int32{p2},
+			before:   []*proxyv1alpha1.TSProxy{aged("young", 1, atomic, p0, p1)},
+			obj:      aged("old", 0, partial, p0, p2),
+			want:     []proxyv1alpha1.ServiceState{active, failed},
+			owners:   map[int32]string{p0: "a/old", p1: ""},
+			notified: []string{"a/young"},
+		},
+		{
+			name:     "Atomic update keeps the previous ports on failure",
+			occupied: []int32{p1},
+			before:   []*proxyv1alpha1.TSProxy{aged("old", 0, atomic, p0)},
+			obj:      aged("old", 0, atomic, p0, p1),
+			want:     []proxyv1alpha1.ServiceState{active, failed},
+			owners:   map[int32]string{p0: "a/old", p1: ""},
+		},
+		{
+			name:     "eviction is undone when the Atomic update rolls back",
+			occupied: []int32{p2},
+			before: []*proxyv1alpha1.TSProxy{
+				aged("old", 0, atomic, p0),
+				aged("young", 1, partial, p1),
+			},
+			obj:    aged("old", 0, atomic, p0, p1, p2),
+			want:   []proxyv1alpha1.ServiceState{active, rejected, failed},
+			owners: map[int32]string{p0: "a/old", p1: "a/young"},
+		},
+		{
+			name:     "Partial apply keeps the services that bind",
+			occupied: []int32{p1},
+			obj:      aged("old", 0, partial, p0, p1),
+			want:     []proxyv1alpha1.ServiceState{active, failed},
+			owners:   map[int32]string{p0: "a/old"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := setup(t)
+			for _, port := range tt.occupied {
+				occupy(t, port)
+			}
+			for _, obj := range tt.before {
+				reload(obj)
+			}
+
+			var notified []string
+			OnChange(func(key types.NamespacedName) {
+				notified = append(notified, key.String())
+			})
+
+			got := states(reload(tt.obj))
+			if len(got) != len(tt.want) {
+				t.Fatalf("states = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("states = %v, want %v", got, tt.want)
+					break
+				}
+			}
+			for port, want := range tt.owners {
+				if got := owner(m, port); got != want {
+					t.Errorf("port %d is bound by %q, want %q", port, got, want)
+				}
+			}
+			for _, key := range tt.notified {
+				found := false
+				for _, n := range notified {
+					found = found || n == key
+				}
+				if !found {
+					t.Errorf("%s not notified, got %v", key, notified)
+				}
+			}
+		})
+	}
+}
+
+func TestReloadAllocates(t *testing.T) {
+	m := setup(t)
+	options.Flags.PortRange = options.PortRange{Min: basePort, Max: basePort + 9}
+
+	auto := func(name string, age int, counts ...int32) *proxyv1alpha1.TSProxy {
+		obj := aged(name, age, proxyv1alpha1.ApplyPartial)
+		for i, count := range counts {
+			obj.Spec.Services = append(obj.Spec.Services, proxyv1alpha1.TSProxyService{
+				Name:        "svc" + strconv.Itoa(i),
+				ServicePort: 80,
+				Count:       count,
+			})
+		}
+		return obj
+	}
+
+	first := auto("first", 0, 2, 1)
+	second := auto("second", 1, 3)
+
+	got := reload(first)
+	if got[0].ExposeAs != basePort || got[1].ExposeAs != basePort+2 {
+		t.Fatalf("first allocated %d and %d", got[0].ExposeAs, got[1].ExposeAs)
+	}
+	first.Status.Services = got
+	got = reload(second)
+	if got[0].ExposeAs != basePort+3 || got[0].State != proxyv1alpha1.ServiceActive {
+		t.Fatalf("second allocated %d (%s)", got[0].ExposeAs, got[0].State)
+	}
+
+	// the ports reported in the status are kept when reloaded
+	if again := reload(first); again[0].ExposeAs != basePort || again[1].ExposeAs != basePort+2 {
+		t.Errorf("first moved to %d and %d", again[0].ExposeAs, again[1].ExposeAs)
+	}
+
+	// released ports are handed out again
+	Reload(context.Background(), types.NamespacedName{Namespace: "a", Name: "first"}, nil)
+	if owner(m, basePort) != "" || len(m.allocated) != 3 {
+		t.Errorf("ports of first not released, allocated %v", m.allocated)
+	}
+	third := auto("third", 2, 1)
+	if got := reload(third); got[0].ExposeAs != basePort {
+		t.Errorf("third allocated %d, want %d", got[0].ExposeAs, basePort)
+	}
+}
@@ -5,9 +5,13 @@ import (
 	"errors"
 	"io"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/AB-Lindex/tsproxy/internal/accesslog"
 	"github.com/AB-Lindex/tsproxy/internal/options"
+	"golang.org/x/time/rate"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
@@ -17,6 +21,59 @@ type connection struct {
 
 	inbound  net.Conn
 	outbound net.Conn
+
+	workers  [2]int
+	started  time.Time
+	limiters limiters
+
+	// ctx is cancelled when the connection ends, releasing the copy workers waiting for bandwidth
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// bytesIn is copied from the client to the backend, bytesOut back to the client
+	bytesIn    atomic.Int64
+	bytesOut   atomic.Int64
+	lastActive atomic.Int64
+
+	// finished counts the directions that reached EOF, halfClose closes the connection when only one did
+	// and the other is idle for the half-close timeout
+	finished  atomic.Int32
+	halfClose atomic.Pointer[time.Timer]
+	closeOnce sync.Once
+
+	// reason is why the connection ended, for the access log
+	reasonMutex sync.Mutex
+	reason      string
+	err         error
+}
+
+// reasons a connection ended, in the access log. Rejected connections have the reason of the rejection as error.
+const (
+	reasonClientClosed     = "client_closed"
+	reasonBackendClosed    = "backend_closed"
+	reasonHalfCloseTimeout = "half_close_timeout"
+	reasonTerminated       = "terminated"
+	reasonError            = "error"
+	reasonDialFailed       = "dial_failed"
+	reasonNoBackend        = "no_backend"
+	reasonRejected         = "rejected"
+)
+
+// eofReasons are the reasons of each direction reaching EOF first
+var eofReasons = [2]string{reasonClientClosed, reasonBackendClosed}
+
+// counter counts the bytes written through it and records when data last passed
+type counter struct {
+	w          io.Writer
+	bytes      *atomic.Int64
+	lastActive *atomic.Int64
+}
+
+func (c *counter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.bytes.Add(int64(n))
+	c.lastActive.Store(time.Now().UnixNano())
+	return n, err
 }
 
 var keepalive = net.KeepAliveConfig{
@@ -38,10 +95,11 @@ func dial(address string) (net.Conn, error) {
 	return net.DialTimeout("tcp", address, 5*time.Second)
 }
 
-func newConnection(ps *proxyservice, listener *listener, accepted net.Conn) (*connection, error) {
-	outbound, err := dial(listener.connectTo)
+func newConnection(ps *proxyservice, listener *listener, accepted net.Conn, target string) (*connection, error) {
+	started := time.Now()
+	outbound, err := dial(target)
 	if err != nil {
-		_ = accepted.Close()
+		listener.reject(accepted, started, target, reasonDialFailed, err.Error())
 		return nil, err
 	}
 
@@ -50,7 +108,11 @@ func newConnection(ps *proxyservice, listener *listener, accepted net.Conn) (*co
 		listener:     listener,
 		inbound:      accepted,
 		outbound:     outbound,
+		started:      started,
+		limiters:     newLimiters(),
 	}
+	conn.ctx, conn.cancel = context.WithCancel(context.Background())
+	conn.lastActive.Store(conn.started.UnixNano())
 
 	return conn, nil
 }
@@ -60,31 +122,163 @@ func (conn *connection) Run(a, b int) {
 	logger.Info("Connection opened",
 		"key", conn.listener.key,
 		"worker", a,
-		"from", conn.inbound.RemoteAddr().String())
+		"from", conn.inbound.RemoteAddr().String(),
+		"kind", conn.listener.kind)
 	// "remote", conn.outbound.RemoteAddr().String())
-	go conn.copy(conn.inbound, conn.outbound, a, a)
-	go conn.copy(conn.outbound, conn.inbound, b, a)
+	go conn.copy(conn.inbound, conn.outbound, upload, &conn.bytesIn, a)
+	go conn.copy(conn.outbound, conn.inbound, download, &conn.bytesOut, b)
 }
 
-func (conn *connection) copy(from, to net.Conn, workerID, primaryID int) {
+// copyChunk is how much data is copied between checks of the bandwidth limits.
+// Without limits the bytes and the time data last passed are recorded once per chunk.
+const copyChunk = 64 << 10
+
+func (conn *connection) copy(from, to net.Conn, dir int, bytes *atomic.Int64, workerID int) {
 	logger := log.FromContext(context.Background())
-	if workerID == primaryID {
-		defer logger.Info("Connection closed",
-			"key", conn.listener.key,
-			"worker", workerID,
-			"from", from.RemoteAddr().String())
+
+	t := &throttle{
+		ctx:        conn.ctx,
+		w:          &counter{w: to, bytes: bytes, lastActive: &conn.lastActive},
+		limiters:   [2]*rate.Limiter{conn.limiters[dir], conn.listener.limiters[dir]},
+		metricsVec: conn.listener.metricsVec,
+		direction:  directions[dir],
 	}
-	defer conn.listener.RemoveConnection(primaryID)
 
-	// Echo all incoming data.
-	_, err := io.Copy(to, from)
+	// Echo all incoming data. Unlimited chunks are copied to the connection itself,
+	// so the kernel moves the data between the sockets with splice.
+	var err error
+	for err == nil {
+		if t.limited() {
+			_, err = io.CopyN(t, from, copyChunk)
+			continue
+		}
+		var n int64
+		n, err = io.CopyN(to, from, copyChunk)
+		if n > 0 {
+			bytes.Add(n)
+			conn.lastActive.Store(time.Now().UnixNano())
+		}
+	}
+	if err == io.EOF {
+		err = nil
+	}
 
-	if errors.Is(err, net.ErrClosed) {
+	if closed(err) {
 		logger.Info("Connection closing", "key", conn.listener.key, "worker", workerID)
 	} else if err != nil {
 		logger.Error(err, "Connection error", "key", conn.listener.key, "worker", workerID)
 	}
-	// Shut down the connection.
-	_ = from.Close()
-	_ = to.Close()
+	conn.finish(to, dir, err)
+}
+
+// finish ends one direction of the connection. The first direction reaching EOF only closes the write side of to,
+// passing the FIN on while the other direction goes on. The connection is closed when both directions are done,
+// on an error, or when no data passes in the other direction for the half-close timeout.
+func (conn *connection) finish(to net.Conn, dir int, err error) {
+	switch {
+	case err == nil:
+		conn.setReason(eofReasons[dir], nil, false)
+	case !closed(err):
+		conn.setReason(reasonError, err, false)
+	}
+
+	if err == nil && conn.finished.Add(1) == 1 && options.Flags.HalfCloseTimeout > 0 {
+		if tcp, ok := to.(interface{ CloseWrite() error }); ok && tcp.CloseWrite() == nil {
+			conn.halfClose.Store(time.AfterFunc(options.Flags.HalfCloseTimeout, conn.halfCloseExpired))
+			return
+		}
+	}
+	conn.close()
+}
+
+// halfCloseExpired closes a half-closed connection idle for the half-close timeout,
+// or checks again when the timeout after the last data passed is up
+func (conn *connection) halfCloseExpired() {
+	idle := time.Since(time.Unix(0, conn.lastActive.Load()))
+	if idle < options.Flags.HalfCloseTimeout {
+		if timer := conn.halfClose.Load(); timer != nil {
+			timer.Reset(options.Flags.HalfCloseTimeout - idle)
+			return
+		}
+	}
+	conn.setReason(reasonHalfCloseTimeout, nil, true)
+	conn.close()
+}
+
+// closed reports whether err is from the connection being closed while copying
+func closed(err error) bool {
+	return errors.Is(err, net.ErrClosed) || errors.Is(err, context.Canceled)
+}
+
+// setReason records why the connection ended. The first reason is kept unless force is set.
+func (conn *connection) setReason(reason string, err error, force bool) {
+	conn.reasonMutex.Lock()
+	defer conn.reasonMutex.Unlock()
+
+	if conn.reason == "" || force {
+		conn.reason, conn.err = reason, err
+	}
+}
+
+// close closes both sides and removes the connection from its listener, once
+func (conn *connection) close() {
+	conn.closeOnce.Do(func() {
+		conn.cancel()
+		if timer := conn.halfClose.Load(); timer != nil {
+			timer.Stop()
+		}
+		_ = conn.inbound.Close()
+		_ = conn.outbound.Close()
+		conn.listener.RemoveConnection(conn.workers[0])
+
+		log.FromContext(context.Background()).Info("Connection closed",
+			"key", conn.listener.key,
+			"worker", conn.workers[0],
+			"from", conn.inbound.RemoteAddr().String())
+
+		conn.reasonMutex.Lock()
+		record := &accesslog.Record{
+			Time:     time.Now(),
+			TSProxy:  conn.proxyservice.key.String(),
+			Listener: conn.listener.key,
+			Port:     localPort(conn.inbound),
+			Client:   conn.inbound.RemoteAddr().String(),
+			Backend:  conn.outbound.RemoteAddr().String(),
+			Start:    conn.started,
+			BytesIn:  conn.bytesIn.Load(),
+			BytesOut: conn.bytesOut.Load(),
+			Reason:   conn.reason,
+		}
+		if conn.err != nil {
+			record.Error = conn.err.Error()
+		}
+		conn.reasonMutex.Unlock()
+		record.Duration = record.Time.Sub(record.Start).Seconds()
+		accesslog.Write(record)
+	})
+}
+
+// reject closes a connection that is not proxied and writes its access log record
+func (conn *listener) reject(accepted net.Conn, started time.Time, backend, reason, message string) {
+	_ = accepted.Close()
+	accesslog.Write(&accesslog.Record{
+		Time:     time.Now(),
+		TSProxy:  conn.proxyservice.key.String(),
+		Listener: conn.key,
+		Port:     localPort(accepted),
+		Client:   accepted.RemoteAddr().String(),
+		Backend:  backend,
+		Start:    started,
+		Duration: time.Since(started).Seconds(),
+		Reason:   reason,
+		Error:    message,
+	})
+}
+
+// localPort returns the exposed port an accepted connection came in on
+func localPort(accepted net.Conn) int {
+	if addr, ok := accepted.LocalAddr().(*net.TCPAddr); ok {
+		return addr.Port
+	}
+	return 0
 }
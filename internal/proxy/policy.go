@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+	"github.com/AB-Lindex/tsproxy/internal/metrics"
+	"github.com/AB-Lindex/tsproxy/internal/options"
+)
+
+// deniedError is returned when a service is not permitted by the operator's policy
+type deniedError struct {
+	reason string
+}
+
+func (e *deniedError) Error() string {
+	return e.reason
+}
+
+// checkAllowed verifies that the count ports from port may be exposed
+// according to the operator-wide allowed and reserved ports
+func checkAllowed(port, count int32) error {
+	for p := port; p < port+count; p++ {
+		if options.Flags.ReservedPorts.Contains(p) {
+			return &deniedError{reason: fmt.Sprintf("ExposeAs %d is reserved by the operator", p)}
+		}
+		if len(options.Flags.AllowedPorts) > 0 && !options.Flags.AllowedPorts.Contains(p) {
+			return &deniedError{reason: fmt.Sprintf("ExposeAs %d is outside the allowed ports %s", p, options.Flags.AllowedPorts)}
+		}
+	}
+	return nil
+}
+
+// CheckPolicy validates the exposed ports of obj against the operator-wide allowed and reserved ports,
+// and its external hosts against the allowed external destinations.
+// Services without exposeAs are allocated later and their ports are not checked.
+func CheckPolicy(obj *proxyv1alpha1.TSProxy) error {
+	var errs []error
+	for i := range obj.Spec.Services {
+		svc := &obj.Spec.Services[i]
+		if svc.Host != "" {
+			if err := checkDestination(svc.Host, svc.ServicePort, svc.PortCount()); err != nil {
+				errs = append(errs, fmt.Errorf("service %s: %w", svc.Name, err))
+			}
+		}
+		if svc.ExposeAs == 0 {
+			continue
+		}
+		if err := checkAllowed(svc.ExposeAs, svc.PortCount()); err != nil {
+			errs = append(errs, fmt.Errorf("service %s (%s): %w",
+				svc.Name, metrics.PortLabel(svc.ExposeAs, svc.PortCount()), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NamespacePolicy limits what the TSProxies of a namespace may expose
+type NamespacePolicy struct {
+	// Name of the TSProxyPolicy, used in messages
+	Name string
+
+	// AllowedPorts may be claimed by the namespace, empty allows all
+	AllowedPorts options.PortRanges
+
+	// MaxPorts and MaxServices limit the namespace, negative means unlimited
+	MaxPorts    int32
+	MaxServices int32
+}
+
+// SetNamespacePolicy sets the policy for a namespace, nil when no policy selects it.
+// Policies are only enforced when enabled with options.Flags.EnforcePolicies.
+func SetNamespacePolicy(namespace string, policy *NamespacePolicy) {
+	tsp.mutex.Lock()
+	defer tsp.mutex.Unlock()
+
+	if policy == nil {
+		delete(tsp.policies, namespace)
+		return
+	}
+	tsp.policies[namespace] = policy
+}
+
+// policyAllows reports whether the policy of namespace permits port to be exposed,
+// so ports are only allocated from the ranges of the namespace
+func (m *manager) policyAllows(namespace string, port int32) bool {
+	if !options.Flags.EnforcePolicies {
+		return true
+	}
+	p := m.policies[namespace]
+	return p == nil || len(p.AllowedPorts) == 0 || p.AllowedPorts.Contains(port)
+}
+
+// usage counts ports and services of a namespace against its policy
+type usage struct {
+	policy   *NamespacePolicy
+	ports    int32
+	services int32
+}
+
+// SetNamespaceProxies sets all TSProxies of a namespace, of any class and node,
+// whose services count against the limits of the namespace policy
+func SetNamespaceProxies(namespace string, list []*proxyv1alpha1.TSProxy) {
+	tsp.mutex.Lock()
+	defer tsp.mutex.Unlock()
+
+	if len(list) == 0 {
+		delete(tsp.peers, namespace)
+		return
+	}
+	tsp.peers[namespace] = list
+}
+
+// namespaceUsage returns the ports and services claimed by the TSProxies of the namespace of obj created before it.
+// The services of each are counted as far as they fit the policy, oldest first, like the ports they contest,
+// so the TSProxies over the limit do not depend on the order they are reconciled in.
+func (m *manager) namespaceUsage(objKey string, obj *proxyv1alpha1.TSProxy) *usage {
+	u := &usage{policy: m.policies[obj.Namespace]}
+
+	var peers []*proxyv1alpha1.TSProxy
+	for _, peer := range m.peers[obj.Namespace] {
+		if key := peerKey(peer); key != objKey && older(peer, key, obj, objKey) {
+			peers = append(peers, peer)
+		}
+	}
+	slices.SortFunc(peers, func(a, b *proxyv1alpha1.TSProxy) int {
+		if older(a, peerKey(a), b, peerKey(b)) {
+			return -1
+		}
+		return 1
+	})
+
+	for _, peer := range peers {
+		for i := range peer.Spec.Services {
+			_ = u.claim(peer.Namespace, &peer.Spec.Services[i])
+		}
+	}
+	return u
+}
+
+func peerKey(obj *proxyv1alpha1.TSProxy) string {
+	return obj.Namespace + "/" + obj.Name
+}
+
+// claim checks svc against the namespace policy and adds it to the usage if permitted
+func (u *usage) claim(namespace string, svc *proxyv1alpha1.TSProxyService) error {
+	if !options.Flags.EnforcePolicies {
+		return nil
+	}
+
+	p := u.policy
+	if p == nil {
+		return &deniedError{reason: fmt.Sprintf("namespace %s is not permitted to use tsproxy by any TSProxyPolicy", namespace)}
+	}
+
+	count := svc.PortCount()
+	// ports to be allocated are taken from the allowed ports
+	if len(p.AllowedPorts) > 0 && svc.ExposeAs != 0 {
+		for port := svc.ExposeAs; port < svc.ExposeAs+count; port++ {
+			if !p.AllowedPorts.Contains(port) {
+				return &deniedError{reason: fmt.Sprintf("ExposeAs %d is outside the ports %s allowed by TSProxyPolicy %s",
+					port, p.AllowedPorts, p.Name)}
+			}
+		}
+	}
+	if p.MaxServices >= 0 && u.services+1 > p.MaxServices {
+		return &deniedError{reason: fmt.Sprintf("namespace %s would exceed the limit of %d services of TSProxyPolicy %s",
+			namespace, p.MaxServices, p.Name)}
+	}
+	if p.MaxPorts >= 0 && u.ports+count > p.MaxPorts {
+		return &deniedError{reason: fmt.Sprintf("namespace %s would exceed the limit of %d ports of TSProxyPolicy %s",
+			namespace, p.MaxPorts, p.Name)}
+	}
+
+	u.services++
+	u.ports += count
+	return nil
+}
@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+	"github.com/AB-Lindex/tsproxy/internal/options"
+)
+
+func TestNamespaceLimits(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	proxy := func(name string, age int, services ...proxyv1alpha1.TSProxyService) *proxyv1alpha1.TSProxy {
+		obj := newTSProxy("a", name, services...)
+		obj.CreationTimestamp = metav1.NewTime(created.Add(time.Duration(age) * time.Hour))
+		return obj
+	}
+	old := proxy("old", 0,
+		proxyv1alpha1.TSProxyService{Name: "db", ServicePort: 5432, ExposeAs: 40000},
+		proxyv1alpha1.TSProxyService{Name: "cache", ServicePort: 6379, ExposeAs: 40001, Count: 2})
+	young := proxy("young", 1,
+		proxyv1alpha1.TSProxyService{Name: "web", ServicePort: 80, ExposeAs: 40010})
+	tie := proxy("b-tie", 0,
+		proxyv1alpha1.TSProxyService{Name: "web", ServicePort: 80, ExposeAs: 40020})
+	outside := proxy("outside", 2,
+		proxyv1alpha1.TSProxyService{Name: "web", ServicePort: 80, ExposeAs: 50000})
+	auto := proxy("auto", 3,
+		proxyv1alpha1.TSProxyService{Name: "web", ServicePort: 80})
+
+	var tests = []struct {
+		name   string
+		policy NamespacePolicy
+		peers  []*proxyv1alpha1.TSProxy
+		obj    *proxyv1alpha1.TSProxy
+		denied []bool
+	}{
+		{
+			name:   "oldest claims first",
+			policy: NamespacePolicy{MaxPorts: -1, MaxServices: 2},
+			peers:  []*proxyv1alpha1.TSProxy{young, old},
+			obj:    old,
+			denied: []bool{false, false},
+		},
+		{
+			name:   "younger over the service limit",
+			policy: NamespacePolicy{MaxPorts: -1, MaxServices: 2},
+			peers:  []*proxyv1alpha1.TSProxy{young, old},
+			obj:    young,
+			denied: []bool{true},
+		},
+		{
+			name:   "younger over the port limit",
+			policy: NamespacePolicy{MaxPorts: 3, MaxServices: -1},
+			peers:  []*proxyv1alpha1.TSProxy{old, young},
+			obj:    young,
+			denied: []bool{true},
+		},
+		{
+			name:   "later services of the same TSProxy",
+			policy: NamespacePolicy{MaxPorts: 2, MaxServices: -1},
+			peers:  []*proxyv1alpha1.TSProxy{old},
+			obj:    old,
+			denied: []bool{false, true},
+		},
+		{
+			name:   "tie broken by name",
+			policy: NamespacePolicy{MaxPorts: -1, MaxServices: 2},
+			peers:  []*proxyv1alpha1.TSProxy{old, tie},
+			obj:    tie,
+			denied: []bool{false},
+		},
+		{
+			name:   "denied services of older TSProxies do not count",
+			policy: NamespacePolicy{AllowedPorts: options.PortRanges{{Min: 40000, Max: 49999}}, MaxPorts: -1, MaxServices: 1},
+			peers:  []*proxyv1alpha1.TSProxy{outside, auto},
+			obj:    auto,
+			denied: []bool{false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := setup(t)
+			options.Flags.EnforcePolicies = true
+			m.policies["a"] = &tt.policy
+			m.peers["a"] = tt.peers
+
+			obj := tt.obj.DeepCopy()
+			if obj.Spec.Services[0].ExposeAs == 0 {
+				obj.Spec.Services[0].ExposeAs = 40100
+			}
+			errs, _ := m.checkServices(peerKey(obj), obj)
+			for i, err := range errs {
+				if denied := errors.As(err, new(*deniedError)); denied != tt.denied[i] {
+					t.Errorf("service %s: denied = %v, want %v (%v)", obj.Spec.Services[i].Name, denied, tt.denied[i], err)
+				}
+			}
+		})
+	}
+}
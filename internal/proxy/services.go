@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+)
+
+// Service is what the proxy needs to know about a Service targeted by a TSProxy
+type Service struct {
+	// ExternalName is the external name of an ExternalName Service, empty for any other Service
+	ExternalName string
+
+	// Ports maps the names of the Service ports to their numbers, a single unnamed port has the name ""
+	Ports map[string]int32
+}
+
+// SetService records a Service targeted by a TSProxy, nil when it does not exist
+func SetService(key types.NamespacedName, service *Service) {
+	tsp.mutex.Lock()
+	defer tsp.mutex.Unlock()
+
+	if service == nil {
+		delete(tsp.services, key)
+		return
+	}
+	tsp.services[key] = service
+}
+
+// targetKey returns the key of the Service targeted by svc of a TSProxy in namespace ns
+func targetKey(ns string, svc *proxyv1alpha1.TSProxyService) types.NamespacedName {
+	return types.NamespacedName{Namespace: targetNamespace(ns, svc), Name: svc.Name}
+}
+
+// servicePort returns the first port proxied on the target of svc, resolving a Service port name.
+// It returns 0 for a port name not known (yet) and for pods, whose ports are resolved per pod.
+func (m *manager) servicePort(ns string, svc *proxyv1alpha1.TSProxyService) int32 {
+	if svc.PortName == "" {
+		return svc.ServicePort
+	}
+	if svc.Selector != nil {
+		return 0
+	}
+	if service := m.services[targetKey(ns, svc)]; service != nil {
+		return service.Ports[svc.PortName]
+	}
+	return 0
+}
+
+// checkPortName verifies that the port name of svc resolves to ports in range on its Service.
+// Without a port number there is nothing to connect to, so this is checked even when not waiting for targets.
+func (m *manager) checkPortName(ns string, svc *proxyv1alpha1.TSProxyService) error {
+	if svc.PortName == "" || svc.Selector != nil {
+		return nil
+	}
+
+	key := targetKey(ns, svc)
+	port := m.servicePort(ns, svc)
+	if port == 0 {
+		if m.services[key] == nil {
+			return &TargetError{Reason: ReasonServiceNotFound, Message: fmt.Sprintf("service %s not found", key)}
+		}
+		return &TargetError{Reason: ReasonPortNotFound, Message: fmt.Sprintf("port %s not found on service %s", svc.PortName, key)}
+	}
+	if port+svc.PortCount()-1 > PORTNO_MAX {
+		return fmt.Errorf("port %s (%d) of service %s is out of range for %d ports", svc.PortName, port, key, svc.PortCount())
+	}
+	return nil
+}
+
+// refreshTargets updates the running listeners of ps with the current ready pods, Service port numbers,
+// bandwidth and client limits, without rebinding their exposed ports
+func (ps *proxyservice) refreshTargets(ctx context.Context) {
+	logger := log.FromContext(ctx)
+
+	if ps.obj == nil {
+		return
+	}
+
+	for i := range ps.obj.Spec.Services {
+		svc := &ps.obj.Spec.Services[i]
+		conn, running := ps.listeners[serviceKey(ps.key.Namespace, svc)]
+		if !running {
+			continue
+		}
+
+		switch {
+		case conn.kind == targetPods:
+			conn.setBackends(tsp.backends[ps.key][conn.key])
+		case svc.PortName != "":
+			port := tsp.servicePort(ps.key.Namespace, svc)
+			if port != 0 && conn.setPort(port) {
+				logger.Info("Service port changed - retargeting", "key", conn.key, "portName", svc.PortName, "port", port)
+			}
+		}
+		conn.setBandwidth(svc.Bandwidth)
+		conn.setClientLimits(svc.ClientLimits)
+	}
+}
+
+// setPort changes the first port proxied on the target, reporting whether it changed
+func (conn *listener) setPort(port int32) bool {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	if conn.svcPort == port {
+		return false
+	}
+	conn.svcPort = port
+	return true
+}
+
+// reasons a target could not be resolved, used in the TargetResolved condition
+const (
+	ReasonServiceNotFound = "ServiceNotFound"
+	ReasonPortNotFound    = "PortNotFound"
+	ReasonNoReadyPods     = "NoReadyPods"
+)
+
+// TargetError explains why the target of a service could not be resolved
+type TargetError struct {
+	Reason  string
+	Message string
+}
+
+func (e *TargetError) Error() string {
+	return e.Message
+}
+
+// ResolveTarget verifies that the Service and ports, or the ready pods, targeted by svc of the TSProxy key exist.
+// It returns a *TargetError when they do not.
+func ResolveTarget(key types.NamespacedName, svc *proxyv1alpha1.TSProxyService) error {
+	tsp.mutex.Lock()
+	defer tsp.mutex.Unlock()
+
+	return tsp.resolveTarget(key, svc)
+}
+
+func (m *manager) resolveTarget(key types.NamespacedName, svc *proxyv1alpha1.TSProxyService) error {
+	switch {
+	case svc.Host != "":
+		return nil
+	case svc.Selector != nil:
+		if len(m.backends[key][serviceKey(key.Namespace, svc)]) == 0 {
+			return &TargetError{Reason: ReasonNoReadyPods, Message: fmt.Sprintf("no ready pods selected by %s", svc.Name)}
+		}
+		return nil
+	}
+
+	target := targetKey(key.Namespace, svc)
+	service := m.services[target]
+	if service == nil {
+		return &TargetError{Reason: ReasonServiceNotFound, Message: fmt.Sprintf("service %s not found", target)}
+	}
+	if service.ExternalName != "" {
+		// the ports of an ExternalName Service are informational
+		return nil
+	}
+	if svc.PortName != "" {
+		if _, found := service.Ports[svc.PortName]; !found {
+			return &TargetError{Reason: ReasonPortNotFound, Message: fmt.Sprintf("port %s not found on service %s", svc.PortName, target)}
+		}
+		return nil
+	}
+
+	for port := svc.ServicePort; port < svc.ServicePort+svc.PortCount(); port++ {
+		if !hasPort(service, port) {
+			return &TargetError{Reason: ReasonPortNotFound, Message: fmt.Sprintf("port %d not found on service %s", port, target)}
+		}
+	}
+	return nil
+}
+
+func hasPort(service *Service, port int32) bool {
+	for _, p := range service.Ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
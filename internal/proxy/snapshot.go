@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"sort"
+	"time"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+	"github.com/AB-Lindex/tsproxy/internal/admin/api"
+)
+
+// Snapshot returns the TSProxies, their services and live connections, sorted by namespace and name
+func Snapshot() []api.TSProxyInfo {
+	tsp.mutex.Lock()
+	defer tsp.mutex.Unlock()
+
+	now := time.Now()
+	var result = make([]api.TSProxyInfo, 0, len(tsp.active))
+	for _, ps := range tsp.active {
+		info := api.TSProxyInfo{Namespace: ps.key.Namespace, Name: ps.key.Name, Services: []api.ServiceInfo{}}
+		for _, st := range ps.services {
+			svc := api.ServiceInfo{TSProxyServiceStatus: st}
+			if conn := ps.listenerFor(&st); conn != nil {
+				svc.Key = conn.key
+				svc.Kind = conn.kind
+				svc.Target = conn.connectTo
+				svc.Connections = conn.snapshot(now)
+				svc.ConnectionCount = len(svc.Connections)
+			}
+			info.Services = append(info.Services, svc)
+		}
+		result = append(result, info)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Namespace != result[j].Namespace {
+			return result[i].Namespace < result[j].Namespace
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// listenerFor returns the running listener of the service reported in st, if any
+func (ps *proxyservice) listenerFor(st *proxyv1alpha1.TSProxyServiceStatus) *listener {
+	for _, conn := range ps.listeners {
+		if conn.name == st.Name && conn.exposeAsPort == st.ExposeAs {
+			return conn
+		}
+	}
+	return nil
+}
+
+// snapshot returns the live connections of the listener, oldest first
+func (conn *listener) snapshot(now time.Time) []api.ConnectionInfo {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	var result = make([]api.ConnectionInfo, 0, len(conn.connections))
+	for id, c := range conn.connections {
+		result = append(result, api.ConnectionInfo{
+			ID:       id,
+			Workers:  c.workers,
+			Client:   c.inbound.RemoteAddr().String(),
+			Backend:  c.outbound.RemoteAddr().String(),
+			Started:  c.started,
+			BytesIn:  c.bytesIn.Load(),
+			BytesOut: c.bytesOut.Load(),
+			Idle:     now.Sub(time.Unix(0, c.lastActive.Load())).Seconds(),
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Started.Before(result[j].Started)
+	})
+	return result
+}
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// CloseConnection terminates the live connection with id, reporting whether it was found
+func CloseConnection(ctx context.Context, id int) bool {
+	tsp.mutex.Lock()
+	defer tsp.mutex.Unlock()
+
+	for _, conn := range tsp.listeners() {
+		if c := conn.connection(id); c != nil {
+			c.terminate(ctx)
+			return true
+		}
+	}
+	return false
+}
+
+// CloseConnectionsFrom terminates every live connection from the client address ip, returning how many
+func CloseConnectionsFrom(ctx context.Context, ip net.IP) int {
+	tsp.mutex.Lock()
+	defer tsp.mutex.Unlock()
+
+	var closed int
+	for _, conn := range tsp.listeners() {
+		for _, c := range conn.connectionList() {
+			if addr, ok := c.inbound.RemoteAddr().(*net.TCPAddr); ok && addr.IP.Equal(ip) {
+				c.terminate(ctx)
+				closed++
+			}
+		}
+	}
+	return closed
+}
+
+// CloseListenerConnections terminates the live connections of the listener exposing port.
+// Without grace they are terminated at once and the number terminated is returned.
+// With a positive grace the listener closes new connections at once while the open ones may finish on their own,
+// and those still open after grace are terminated before it accepts again. drained is then called with the number
+// terminated, and the number open now is returned. The bool reports whether there is a listener on port.
+func CloseListenerConnections(ctx context.Context, port int32, grace time.Duration, drained func(terminated int)) (int, bool) {
+	tsp.mutex.Lock()
+	defer tsp.mutex.Unlock()
+
+	conn, found := tsp.ports[port]
+	if !found {
+		return 0, false
+	}
+	if grace <= 0 {
+		return conn.terminateAll(ctx), true
+	}
+
+	open := len(conn.connectionList())
+	log.FromContext(ctx).Info("Draining connections", "key", conn.key, "connections", open, "grace", grace)
+	ctx = context.WithoutCancel(ctx)
+	conn.draining.Add(1)
+	time.AfterFunc(grace, func() {
+		terminated := conn.terminateAll(ctx)
+		conn.draining.Add(-1)
+		drained(terminated)
+	})
+	return open, true
+}
+
+// terminateAll terminates every live connection of the listener, returning how many
+func (conn *listener) terminateAll(ctx context.Context) int {
+	connections := conn.connectionList()
+	for _, c := range connections {
+		c.terminate(ctx)
+	}
+	return len(connections)
+}
+
+// listeners returns every running listener once, also when it exposes a range of ports
+func (m *manager) listeners() []*listener {
+	var result []*listener
+	for _, ps := range m.active {
+		for _, conn := range ps.listeners {
+			result = append(result, conn)
+		}
+	}
+	return result
+}
+
+func (conn *listener) connection(id int) *connection {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	return conn.connections[id]
+}
+
+func (conn *listener) connectionList() []*connection {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+
+	var result = make([]*connection, 0, len(conn.connections))
+	for _, c := range conn.connections {
+		result = append(result, c)
+	}
+	return result
+}
+
+// terminate closes both sides of the connection, ending its copy workers, also while they wait for bandwidth
+func (c *connection) terminate(ctx context.Context) {
+	log.FromContext(ctx).Info("Terminating connection",
+		"key", c.listener.key,
+		"worker", c.workers[0],
+		"from", c.inbound.RemoteAddr().String())
+	c.setReason(reasonTerminated, nil, true)
+	c.cancel()
+	_ = c.inbound.Close()
+	_ = c.outbound.Close()
+}
@@ -0,0 +1,271 @@
+// Package standalone runs the proxy from TSProxy documents in a local file, without the Kubernetes API
+package standalone
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+	"github.com/AB-Lindex/tsproxy/internal/proxy"
+)
+
+// defaultNamespace is used for TSProxies without a namespace
+const defaultNamespace = "default"
+
+// settleTime collects the burst of events of a single save before reloading
+const settleTime = 200 * time.Millisecond
+
+// retryInterval is how often a TSProxy with inactive services is retried
+const retryInterval = 30 * time.Second
+
+// Load reads the TSProxy documents in path.
+// A service host given as host:port also sets the port when it is omitted.
+func Load(path string) (map[types.NamespacedName]*proxyv1alpha1.TSProxy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse decodes the YAML or JSON TSProxy documents in data
+func Parse(data []byte) (map[types.NamespacedName]*proxyv1alpha1.TSProxy, error) {
+	var result = make(map[types.NamespacedName]*proxyv1alpha1.TSProxy)
+
+	decoder := yaml.NewYAMLOrJSONDecoder(bytes.NewReader(data), 4096)
+	for doc := 1; ; doc++ {
+		obj := &proxyv1alpha1.TSProxy{}
+		if err := decoder.Decode(obj); err != nil {
+			if errors.Is(err, io.EOF) {
+				return result, nil
+			}
+			return nil, fmt.Errorf("document %d: %w", doc, err)
+		}
+		if obj.Kind == "" && obj.Name == "" {
+			// empty document
+			continue
+		}
+		if obj.Kind != "TSProxy" {
+			return nil, fmt.Errorf("document %d: unsupported kind %q", doc, obj.Kind)
+		}
+		if obj.Name == "" {
+			return nil, fmt.Errorf("document %d: metadata.name is required", doc)
+		}
+		if obj.Namespace == "" {
+			obj.Namespace = defaultNamespace
+		}
+		if obj.Spec.ApplyPolicy == "" {
+			obj.Spec.ApplyPolicy = proxyv1alpha1.ApplyPartial
+		}
+
+		for i := range obj.Spec.Services {
+			if err := checkService(&obj.Spec.Services[i]); err != nil {
+				return nil, fmt.Errorf("document %d: %s: %w", doc, obj.Name, err)
+			}
+		}
+
+		key := types.NamespacedName{Namespace: obj.Namespace, Name: obj.Name}
+		if _, found := result[key]; found {
+			return nil, fmt.Errorf("document %d: duplicate TSProxy %s", doc, key)
+		}
+		result[key] = obj
+	}
+}
+
+// checkService requires svc to target a host and port, since services, pods and namespaces
+// can not be resolved without the Kubernetes API
+func checkService(svc *proxyv1alpha1.TSProxyService) error {
+	switch {
+	case svc.Selector != nil:
+		return fmt.Errorf("service %s: selector is not supported without the Kubernetes API", svc.Name)
+	case svc.PortName != "":
+		return fmt.Errorf("service %s: portName is not supported without the Kubernetes API", svc.Name)
+	case svc.Namespace != "":
+		return fmt.Errorf("service %s: namespace is not supported without the Kubernetes API", svc.Name)
+	case svc.Host == "":
+		return fmt.Errorf("service %s: host is required, given as host:port", svc.Name)
+	}
+	if err := splitHostPort(svc); err != nil {
+		return err
+	}
+	if svc.ServicePort == 0 {
+		return fmt.Errorf("service %s: host %q has no port", svc.Name, svc.Host)
+	}
+	return nil
+}
+
+// splitHostPort moves the port of a host given as host:port to the port of svc
+func splitHostPort(svc *proxyv1alpha1.TSProxyService) error {
+	host, port, err := net.SplitHostPort(svc.Host)
+	if err != nil {
+		// no port in host
+		return nil
+	}
+	p, err := strconv.ParseInt(port, 10, 32)
+	if err != nil {
+		return fmt.Errorf("service %s: invalid port in host %q", svc.Name, svc.Host)
+	}
+	if svc.ServicePort != 0 && svc.ServicePort != int32(p) {
+		return fmt.Errorf("service %s: host %q and port %d disagree", svc.Name, svc.Host, svc.ServicePort)
+	}
+	svc.Host, svc.ServicePort = host, int32(p)
+	return nil
+}
+
+// runner applies the TSProxies of a file and keeps their status between reloads
+type runner struct {
+	path    string
+	objects map[types.NamespacedName]*proxyv1alpha1.TSProxy
+
+	// target and data are the file path resolves to and its contents, as last loaded
+	target string
+	data   []byte
+}
+
+// Run applies the TSProxies in path and reapplies them whenever the file changes, until ctx is done
+func Run(ctx context.Context, path string) error {
+	logger := log.FromContext(ctx)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// watch the directory, since editors replace the file and ConfigMap mounts swap the ..data symlink
+	// in it, without any event naming the file
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	changed := make(chan types.NamespacedName, 16)
+	proxy.OnChange(func(key types.NamespacedName) {
+		go func() { changed <- key }()
+	})
+
+	r := &runner{path: path, objects: make(map[types.NamespacedName]*proxyv1alpha1.TSProxy)}
+	if err := r.reload(ctx); err != nil {
+		return err
+	}
+
+	retry := time.NewTicker(retryInterval)
+	defer retry.Stop()
+
+	var settle <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			for key := range r.objects {
+				proxy.Reload(ctx, key, nil)
+			}
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op != fsnotify.Chmod {
+				settle = time.After(settleTime)
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Error(err, "Watching config file failed", "path", path)
+
+		case <-settle:
+			settle = nil
+			if err := r.reload(ctx); err != nil {
+				logger.Error(err, "Unable to reload config file - keeping the current TSProxies", "path", path)
+			}
+
+		case key := <-changed:
+			if obj, found := r.objects[key]; found {
+				r.apply(ctx, key, obj)
+			}
+
+		case <-retry.C:
+			for key, obj := range r.objects {
+				if !isActive(obj) {
+					r.apply(ctx, key, obj)
+				}
+			}
+		}
+	}
+}
+
+// reload reads the file and, when it resolves to another file or its contents changed,
+// closes the TSProxies removed from it and applies the rest
+func (r *runner) reload(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+
+	target, err := filepath.EvalSymlinks(r.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(target)
+	if err != nil {
+		return err
+	}
+	if r.data != nil && target == r.target && bytes.Equal(data, r.data) {
+		return nil
+	}
+
+	objects, err := Parse(data)
+	if err != nil {
+		return err
+	}
+	r.target, r.data = target, data
+	logger.Info("Loaded config file", "path", r.path, "tsproxies", len(objects))
+
+	for key := range r.objects {
+		if _, found := objects[key]; !found {
+			proxy.Reload(ctx, key, nil)
+			delete(r.objects, key)
+		}
+	}
+	for key, obj := range objects {
+		if prev, found := r.objects[key]; found {
+			obj.Status = prev.Status
+		}
+		r.objects[key] = obj
+		r.apply(ctx, key, obj)
+	}
+	return nil
+}
+
+// apply reloads a single TSProxy and logs the services that are not active
+func (r *runner) apply(ctx context.Context, key types.NamespacedName, obj *proxyv1alpha1.TSProxy) {
+	logger := log.FromContext(ctx)
+
+	obj.Status.Services = proxy.Reload(ctx, key, obj)
+	for _, svc := range obj.Status.Services {
+		if svc.State != proxyv1alpha1.ServiceActive {
+			logger.Info("Service not active", "namespace", key.Namespace, "name", key.Name,
+				"service", svc.Name, "state", svc.State, "message", svc.Message)
+		}
+	}
+}
+
+func isActive(obj *proxyv1alpha1.TSProxy) bool {
+	for _, svc := range obj.Status.Services {
+		if svc.State != proxyv1alpha1.ServiceActive {
+			return false
+		}
+	}
+	return true
+}
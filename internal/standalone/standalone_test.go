@@ -0,0 +1,81 @@
+package standalone
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+)
+
+const config = `
+apiVersion: proxy.lindex.com/v1alpha1
+kind: TSProxy
+metadata:
+  name: database
+spec:
+  services:
+  - name: postgres
+    host: db.example.com:5432
+    exposeAs: 15432
+---
+apiVersion: proxy.lindex.com/v1alpha1
+kind: TSProxy
+metadata:
+  name: cache
+  namespace: edge
+spec:
+  applyPolicy: Atomic
+  services:
+  - name: redis
+    host: 10.0.0.5
+    port: 6379
+    exposeAs: 16379
+`
+
+func TestParse(t *testing.T) {
+	objects, err := Parse([]byte(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 {
+		t.Fatalf("got %d TSProxies, want 2", len(objects))
+	}
+
+	db := objects[types.NamespacedName{Namespace: defaultNamespace, Name: "database"}]
+	if db == nil {
+		t.Fatal("TSProxy database not in the default namespace")
+	}
+	if db.Spec.ApplyPolicy != proxyv1alpha1.ApplyPartial {
+		t.Errorf("applyPolicy = %q, want %q", db.Spec.ApplyPolicy, proxyv1alpha1.ApplyPartial)
+	}
+	if svc := db.Spec.Services[0]; svc.Host != "db.example.com" || svc.ServicePort != 5432 {
+		t.Errorf("host:port split into %q and %d", svc.Host, svc.ServicePort)
+	}
+
+	cache := objects[types.NamespacedName{Namespace: "edge", Name: "cache"}]
+	if cache == nil {
+		t.Fatal("TSProxy edge/cache missing")
+	}
+	if svc := cache.Spec.Services[0]; svc.Host != "10.0.0.5" || svc.ServicePort != 6379 {
+		t.Errorf("got %q and %d", svc.Host, svc.ServicePort)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for name, doc := range map[string]string{
+		"kind":      "kind: Service\nmetadata:\n  name: x\n",
+		"name":      "kind: TSProxy\n",
+		"duplicate": "kind: TSProxy\nmetadata:\n  name: x\n---\nkind: TSProxy\nmetadata:\n  name: x\n",
+		"port":      "kind: TSProxy\nmetadata:\n  name: x\nspec:\n  services:\n  - name: a\n    host: h:1\n    port: 2\n",
+		"no host":   "kind: TSProxy\nmetadata:\n  name: x\nspec:\n  services:\n  - name: a\n    port: 2\n",
+		"no port":   "kind: TSProxy\nmetadata:\n  name: x\nspec:\n  services:\n  - name: a\n    host: h\n",
+		"selector":  "kind: TSProxy\nmetadata:\n  name: x\nspec:\n  services:\n  - name: a\n    host: h:1\n    selector: {}\n",
+		"portName":  "kind: TSProxy\nmetadata:\n  name: x\nspec:\n  services:\n  - name: a\n    host: h\n    portName: db\n",
+		"namespace": "kind: TSProxy\nmetadata:\n  name: x\nspec:\n  services:\n  - name: a\n    host: h:1\n    namespace: b\n",
+	} {
+		if _, err := Parse([]byte(doc)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
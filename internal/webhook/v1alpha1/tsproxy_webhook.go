@@ -0,0 +1,72 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	proxyv1alpha1 "github.com/AB-Lindex/tsproxy/api/v1alpha1"
+	"github.com/AB-Lindex/tsproxy/internal/options"
+	"github.com/AB-Lindex/tsproxy/internal/proxy"
+)
+
+// SetupTSProxyWebhookWithManager registers the webhook for TSProxy in the manager.
+func SetupTSProxyWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&proxyv1alpha1.TSProxy{}).
+		WithValidator(&TSProxyCustomValidator{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-proxy-lindex-com-v1alpha1-tsproxy,mutating=false,failurePolicy=fail,sideEffects=None,groups=proxy.lindex.com,resources=tsproxies,verbs=create;update,versions=v1alpha1,name=vtsproxy.kb.io,admissionReviewVersions=v1
+
+// TSProxyCustomValidator rejects TSProxies exposing ports the operator does not allow.
+// Port conflicts between TSProxies are not checked here, they are reported in the status.
+type TSProxyCustomValidator struct{}
+
+var _ admission.CustomValidator = &TSProxyCustomValidator{}
+
+// ValidateCreate implements admission.CustomValidator
+func (v *TSProxyCustomValidator) ValidateCreate(_ context.Context, obj runtime.Object) (admission.Warnings, error) {
+	return nil, validate(obj)
+}
+
+// ValidateUpdate implements admission.CustomValidator
+func (v *TSProxyCustomValidator) ValidateUpdate(_ context.Context, _, newObj runtime.Object) (admission.Warnings, error) {
+	return nil, validate(newObj)
+}
+
+// ValidateDelete implements admission.CustomValidator
+func (v *TSProxyCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func validate(obj runtime.Object) error {
+	tsproxy, ok := obj.(*proxyv1alpha1.TSProxy)
+	if !ok {
+		return fmt.Errorf("expected a TSProxy object but got %T", obj)
+	}
+	// TSProxies of another class are validated by the deployment handling them
+	if !options.HandlesClass(tsproxy.Spec.ProxyClassName) {
+		return nil
+	}
+	return proxy.CheckPolicy(tsproxy)
+}